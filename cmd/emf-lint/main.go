@@ -0,0 +1,224 @@
+// Package main implements the tool.
+//
+// emf-lint validates newline-delimited EMF documents read from files
+// or stdin, reporting errors with line numbers, and summarizes the
+// metrics and dimension sets CloudWatch would extract.
+//
+// Usage:
+//
+//	emf-lint [-summary=false] [-ignore-non-emf] [file ...]
+//
+// Without files, or with file "-", emf-lint reads stdin.
+// Exit status is 0 when all documents are valid, 1 when any document
+// is invalid and 2 on usage or I/O errors.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+const (
+	exitOk      = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+type config struct {
+	summary      bool
+	ignoreNonEMF bool
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("emf-lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var cfg config
+	flags.BoolVar(&cfg.summary, "summary", true, "print summary of metrics CloudWatch would extract")
+	flags.BoolVar(&cfg.ignoreNonEMF, "ignore-non-emf", false, "skip lines that are not JSON objects with _aws member, like plain log lines")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	l := newLinter(cfg, stdout)
+
+	for _, name := range files {
+		if err := l.lintFile(name, stdin); err != nil {
+			fmt.Fprintf(stderr, "emf-lint: %v\n", err)
+			return exitError
+		}
+	}
+
+	if cfg.summary {
+		l.printSummary()
+	}
+
+	if l.invalid > 0 {
+		return exitInvalid
+	}
+	return exitOk
+}
+
+type linter struct {
+	cfg     config
+	out     io.Writer
+	lines   int
+	valid   int
+	invalid int
+	skipped int
+	series  map[seriesKey]int // series => datum count
+}
+
+// seriesKey identifies a metric series extracted by CloudWatch.
+type seriesKey struct {
+	namespace  string
+	metric     string
+	unit       string
+	resolution int
+	dimensions string // sorted dimension names
+}
+
+func newLinter(cfg config, out io.Writer) *linter {
+	return &linter{
+		cfg:    cfg,
+		out:    out,
+		series: map[seriesKey]int{},
+	}
+}
+
+func (l *linter) lintFile(name string, stdin io.Reader) error {
+	if name == "-" {
+		return l.lint("stdin", stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return l.lint(name, f)
+}
+
+func (l *linter) lint(name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*emf.MaxDocumentSize)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if l.cfg.ignoreNonEMF && !looksLikeEMF(line) {
+			l.skipped++
+			continue
+		}
+		l.lines++
+		l.lintLine(fmt.Sprintf("%s:%d", name, lineNumber), line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s:%d: %w", name, lineNumber+1, err)
+	}
+	return nil
+}
+
+func (l *linter) lintLine(location string, line []byte) {
+	if err := emf.Validate(line); err != nil {
+		l.invalid++
+		for _, e := range splitErrors(err) {
+			fmt.Fprintf(l.out, "%s: %v\n", location, e)
+		}
+		return
+	}
+
+	l.valid++
+
+	doc, err := emf.Parse(line)
+	if err != nil {
+		// valid documents are always parseable
+		fmt.Fprintf(l.out, "%s: %v\n", location, err)
+		return
+	}
+	for _, d := range doc.Datums {
+		names := make([]string, 0, len(d.Dimensions))
+		for k := range d.Dimensions {
+			names = append(names, k)
+		}
+		slices.Sort(names)
+		key := seriesKey{
+			namespace:  d.Namespace,
+			metric:     d.Metric.Name,
+			unit:       d.Metric.Unit,
+			resolution: d.Metric.StorageResolution,
+			dimensions: strings.Join(names, ","),
+		}
+		l.series[key]++
+	}
+}
+
+func (l *linter) printSummary() {
+	fmt.Fprintf(l.out, "documents: %d valid: %d invalid: %d", l.lines, l.valid, l.invalid)
+	if l.cfg.ignoreNonEMF {
+		fmt.Fprintf(l.out, " skipped: %d", l.skipped)
+	}
+	fmt.Fprintln(l.out)
+
+	keys := make([]seriesKey, 0, len(l.series))
+	for k := range l.series {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b seriesKey) int {
+		return cmp.Or(
+			strings.Compare(a.namespace, b.namespace),
+			strings.Compare(a.metric, b.metric),
+			strings.Compare(a.dimensions, b.dimensions),
+			strings.Compare(a.unit, b.unit),
+			cmp.Compare(a.resolution, b.resolution),
+		)
+	})
+
+	for _, k := range keys {
+		unit := k.unit
+		if unit == "" {
+			unit = "None"
+		}
+		resolution := k.resolution
+		if resolution == 0 {
+			resolution = 60
+		}
+		fmt.Fprintf(l.out, "namespace=%s metric=%s unit=%s resolution=%d dimensions=[%s] datums=%d\n",
+			k.namespace, k.metric, unit, resolution, k.dimensions, l.series[k])
+	}
+}
+
+// looksLikeEMF reports whether line is a JSON object carrying _aws,
+// telling EMF documents, even invalid ones, apart from other log lines.
+func looksLikeEMF(line []byte) bool {
+	return line[0] == '{' && bytes.Contains(line, []byte(`"_aws"`))
+}
+
+// splitErrors unwraps errors joined by errors.Join.
+func splitErrors(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	validLine   = `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[["a"],["a","b"]],"Metrics":[{"Name":"m","Unit":"Count"}]}]},"a":"1","b":"2","m":1}`
+	invalidLine = `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[["a"]],"Metrics":[{"Name":"m","Unit":"Meters"}]}]},"m":"x"}`
+)
+
+// go test -v -count 1 -run '^TestLintValid$' ./cmd/emf-lint
+func TestLintValid(t *testing.T) {
+	input := validLine + "\n\n" + validLine + "\n"
+	var stdout, stderr bytes.Buffer
+	code := run(nil, strings.NewReader(input), &stdout, &stderr)
+	if code != exitOk {
+		t.Fatalf("exit code: expected=%d got=%d stdout=%s stderr=%s", exitOk, code, stdout.String(), stderr.String())
+	}
+
+	const expect = `documents: 2 valid: 2 invalid: 0
+namespace=ns metric=m unit=Count resolution=60 dimensions=[a] datums=2
+namespace=ns metric=m unit=Count resolution=60 dimensions=[a,b] datums=2
+`
+	if got := stdout.String(); got != expect {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+}
+
+// go test -v -count 1 -run '^TestLintInvalid$' ./cmd/emf-lint
+func TestLintInvalid(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.log")
+	if err := os.WriteFile(file, []byte(validLine+"\n"+invalidLine+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-summary=false", file}, nil, &stdout, &stderr)
+	if code != exitInvalid {
+		t.Fatalf("exit code: expected=%d got=%d", exitInvalid, code)
+	}
+
+	out := stdout.String()
+	t.Logf("output:\n%s", out)
+	for _, expect := range []string{
+		file + `:2: _aws.CloudWatchMetrics[0].Dimensions[0][0]: dimension "a" has no root member`,
+		file + `:2: _aws.CloudWatchMetrics[0].Metrics[0].Unit: invalid unit "Meters"`,
+		file + `:2: m: metric value must be a number or an array of numbers, got string`,
+	} {
+		if !strings.Contains(out, expect) {
+			t.Errorf("missing error: %s", expect)
+		}
+	}
+	if strings.Contains(out, ":1:") {
+		t.Errorf("valid line reported")
+	}
+	if strings.Contains(out, "documents:") {
+		t.Errorf("summary must be disabled")
+	}
+}
+
+// go test -v -count 1 -run '^TestLintIgnoreNonEMF$' ./cmd/emf-lint
+func TestLintIgnoreNonEMF(t *testing.T) {
+	input := "2024/01/01 starting server\n" + validLine + "\n"
+
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, strings.NewReader(input), &stdout, &stderr); code != exitInvalid {
+		t.Fatalf("exit code: expected=%d got=%d", exitInvalid, code)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-ignore-non-emf"}, strings.NewReader(input), &stdout, &stderr); code != exitOk {
+		t.Fatalf("exit code: expected=%d got=%d: %s", exitOk, code, stdout.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "documents: 1 valid: 1 invalid: 0 skipped: 1\n") {
+		t.Fatalf("unexpected summary: %s", stdout.String())
+	}
+}
+
+// go test -v -count 1 -run '^TestLintMissingFile$' ./cmd/emf-lint
+func TestLintMissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{filepath.Join(t.TempDir(), "missing")}, nil, &stdout, &stderr)
+	if code != exitError {
+		t.Fatalf("exit code: expected=%d got=%d", exitError, code)
+	}
+}
@@ -0,0 +1,287 @@
+// Package main implements the tool.
+//
+// emf-send reads newline-delimited EMF documents from files or stdin
+// and ships them to CloudWatch Logs with PutLogEvents.
+// Events are timestamped from _aws.Timestamp, sorted chronologically
+// and split into batches that respect PutLogEvents limits.
+//
+// Usage:
+//
+//	emf-send -group name -stream name [-create] [-retention days]
+//	         [-region region] [-endpoint-url url] [-dry-run] [file ...]
+//
+// Without files, or with file "-", emf-send reads stdin.
+// Nothing is sent if any line is not a valid EMF document.
+// Exit status is 0 on success, 1 when input is invalid or CloudWatch
+// rejects events, and 2 on usage, I/O or API errors.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/udhos/aws-emf/emf"
+)
+
+const (
+	exitOk      = 0
+	exitInvalid = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr, newClient))
+}
+
+// logsClient is the subset of the cloudwatchlogs client used by emf-send.
+type logsClient interface {
+	CreateLogGroup(ctx context.Context, params *cloudwatchlogs.CreateLogGroupInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutRetentionPolicy(ctx context.Context, params *cloudwatchlogs.PutRetentionPolicyInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error)
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+type clientFactory func(ctx context.Context, cfg options) (logsClient, error)
+
+type options struct {
+	group       string
+	stream      string
+	create      bool
+	retention   int
+	region      string
+	endpointURL string
+	dryRun      bool
+}
+
+func newClient(ctx context.Context, opt options) (logsClient, error) {
+	var loadOptions []func(*config.LoadOptions) error
+	if opt.region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(opt.region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return cloudwatchlogs.NewFromConfig(cfg, func(o *cloudwatchlogs.Options) {
+		if opt.endpointURL != "" {
+			o.BaseEndpoint = aws.String(opt.endpointURL)
+		}
+	}), nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer, factory clientFactory) int {
+	flags := flag.NewFlagSet("emf-send", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var opt options
+	flags.StringVar(&opt.group, "group", "", "log group name (required)")
+	flags.StringVar(&opt.stream, "stream", "", "log stream name (required)")
+	flags.BoolVar(&opt.create, "create", false, "create log group and log stream if missing")
+	flags.IntVar(&opt.retention, "retention", 0, "set log group retention in days, 0 leaves retention unchanged")
+	flags.StringVar(&opt.region, "region", "", "AWS region, defaults to AWS SDK configuration")
+	flags.StringVar(&opt.endpointURL, "endpoint-url", "", "override CloudWatch Logs endpoint URL, like a local stand-in")
+	flags.BoolVar(&opt.dryRun, "dry-run", false, "print batches instead of sending them")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if opt.group == "" || opt.stream == "" {
+		fmt.Fprintln(stderr, "emf-send: -group and -stream are required")
+		return exitError
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var events []types.InputLogEvent
+	var invalid int
+	for _, name := range files {
+		list, bad, err := readFile(name, stdin, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "emf-send: %v\n", err)
+			return exitError
+		}
+		events = append(events, list...)
+		invalid += bad
+	}
+	if invalid > 0 {
+		fmt.Fprintf(stderr, "emf-send: %d invalid documents, nothing sent\n", invalid)
+		return exitInvalid
+	}
+
+	batches := emf.BatchLogEvents(events)
+
+	if opt.dryRun {
+		printBatches(stdout, opt, batches)
+		return exitOk
+	}
+
+	client, err := factory(ctx, opt)
+	if err != nil {
+		fmt.Fprintf(stderr, "emf-send: %v\n", err)
+		return exitError
+	}
+
+	if err := prepare(ctx, client, opt); err != nil {
+		fmt.Fprintf(stderr, "emf-send: %v\n", err)
+		return exitError
+	}
+
+	var rejected int
+	for i, batch := range batches {
+		out, err := client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(opt.group),
+			LogStreamName: aws.String(opt.stream),
+			LogEvents:     batch,
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "emf-send: batch %d: %v\n", i+1, err)
+			return exitError
+		}
+		if n := countRejected(out.RejectedLogEventsInfo, len(batch)); n > 0 {
+			fmt.Fprintf(stderr, "emf-send: batch %d: %d events rejected\n", i+1, n)
+			rejected += n
+		}
+	}
+
+	fmt.Fprintf(stdout, "sent %d events in %d batches to %s/%s\n",
+		len(events)-rejected, len(batches), opt.group, opt.stream)
+
+	if rejected > 0 {
+		return exitInvalid
+	}
+	return exitOk
+}
+
+// readFile reads EMF events from file name, reporting invalid lines to stderr.
+func readFile(name string, stdin io.Reader, stderr io.Writer) ([]types.InputLogEvent, int, error) {
+	if name == "-" {
+		return readEvents("stdin", stdin, stderr)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return readEvents(name, f, stderr)
+}
+
+func readEvents(name string, r io.Reader, stderr io.Writer) ([]types.InputLogEvent, int, error) {
+	var events []types.InputLogEvent
+	var invalid int
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*emf.MaxDocumentSize)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := emf.Validate(line); err != nil {
+			fmt.Fprintf(stderr, "%s:%d: %v\n", name, lineNumber, err)
+			invalid++
+			continue
+		}
+		doc, err := emf.Parse(line)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s:%d: %v\n", name, lineNumber, err)
+			invalid++
+			continue
+		}
+		events = append(events, types.InputLogEvent{
+			Message:   aws.String(string(line)),
+			Timestamp: aws.Int64(doc.Metadata.Timestamp),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("%s:%d: %w", name, lineNumber+1, err)
+	}
+	return events, invalid, nil
+}
+
+// prepare creates log group and stream, and sets retention, as requested.
+func prepare(ctx context.Context, client logsClient, opt options) error {
+	if opt.create {
+		_, err := client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(opt.group),
+		})
+		if err != nil && !alreadyExists(err) {
+			return fmt.Errorf("create log group: %w", err)
+		}
+	}
+	if opt.retention > 0 {
+		_, err := client.PutRetentionPolicy(ctx, &cloudwatchlogs.PutRetentionPolicyInput{
+			LogGroupName:    aws.String(opt.group),
+			RetentionInDays: aws.Int32(int32(opt.retention)),
+		})
+		if err != nil {
+			return fmt.Errorf("put retention policy: %w", err)
+		}
+	}
+	if opt.create {
+		_, err := client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+			LogGroupName:  aws.String(opt.group),
+			LogStreamName: aws.String(opt.stream),
+		})
+		if err != nil && !alreadyExists(err) {
+			return fmt.Errorf("create log stream: %w", err)
+		}
+	}
+	return nil
+}
+
+func alreadyExists(err error) bool {
+	var exists *types.ResourceAlreadyExistsException
+	return errors.As(err, &exists)
+}
+
+// countRejected counts events rejected by PutLogEvents.
+// Indexes in info refer to positions in the batch.
+func countRejected(info *types.RejectedLogEventsInfo, size int) int {
+	if info == nil {
+		return 0
+	}
+	var n int
+	if i := info.TooOldLogEventEndIndex; i != nil {
+		n += int(*i) // events before index are too old
+	}
+	if i := info.ExpiredLogEventEndIndex; i != nil {
+		n = max(n, int(*i))
+	}
+	if i := info.TooNewLogEventStartIndex; i != nil {
+		n += size - int(*i) // events from index on are too new
+	}
+	return n
+}
+
+func printBatches(w io.Writer, opt options, batches [][]types.InputLogEvent) {
+	var total int
+	for i, batch := range batches {
+		var size int
+		for _, e := range batch {
+			size += len(aws.ToString(e.Message)) + emf.LogEventOverhead
+		}
+		total += len(batch)
+		fmt.Fprintf(w, "batch %d: events=%d bytes=%d first=%d last=%d\n",
+			i+1, len(batch), size,
+			aws.ToInt64(batch[0].Timestamp),
+			aws.ToInt64(batch[len(batch)-1].Timestamp))
+	}
+	fmt.Fprintf(w, "dry run: %d events in %d batches for %s/%s\n",
+		total, len(batches), opt.group, opt.stream)
+}
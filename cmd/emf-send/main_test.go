@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/udhos/aws-emf/emf/emftest"
+)
+
+func emfLine(ts int64, value int) string {
+	doc := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": ts,
+			"CloudWatchMetrics": []any{map[string]any{
+				"Namespace":  "ns",
+				"Dimensions": [][]string{{"host"}},
+				"Metrics":    []any{map[string]any{"Name": "m", "Unit": "Count"}},
+			}},
+		},
+		"host": "a",
+		"m":    value,
+	}
+	data, _ := json.Marshal(doc)
+	return string(data)
+}
+
+// fakeLogs records calls and extracts metrics with emftest.
+type fakeLogs struct {
+	*emftest.CloudWatch
+	calls   []string
+	batches [][]int64 // timestamps per batch
+}
+
+func (f *fakeLogs) CreateLogGroup(_ context.Context, params *cloudwatchlogs.CreateLogGroupInput,
+	_ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogGroupOutput, error) {
+	f.calls = append(f.calls, "CreateLogGroup "+aws.ToString(params.LogGroupName))
+	return &cloudwatchlogs.CreateLogGroupOutput{}, &types.ResourceAlreadyExistsException{}
+}
+
+func (f *fakeLogs) CreateLogStream(_ context.Context, params *cloudwatchlogs.CreateLogStreamInput,
+	_ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	f.calls = append(f.calls, "CreateLogStream "+aws.ToString(params.LogStreamName))
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (f *fakeLogs) PutRetentionPolicy(_ context.Context, params *cloudwatchlogs.PutRetentionPolicyInput,
+	_ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutRetentionPolicyOutput, error) {
+	f.calls = append(f.calls, "PutRetentionPolicy "+aws.ToString(params.LogGroupName))
+	return &cloudwatchlogs.PutRetentionPolicyOutput{}, nil
+}
+
+func (f *fakeLogs) PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput,
+	optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	f.calls = append(f.calls, "PutLogEvents "+aws.ToString(params.LogStreamName))
+	var ts []int64
+	for _, e := range params.LogEvents {
+		ts = append(ts, aws.ToInt64(e.Timestamp))
+	}
+	f.batches = append(f.batches, ts)
+	return f.CloudWatch.PutLogEvents(ctx, params, optFns...)
+}
+
+// go test -v -count 1 -run '^TestSend$' ./cmd/emf-send
+func TestSend(t *testing.T) {
+	fake := &fakeLogs{CloudWatch: emftest.New()}
+	factory := func(context.Context, options) (logsClient, error) { return fake, nil }
+
+	input := emfLine(3000, 3) + "\n" + emfLine(1000, 1) + "\n\n" + emfLine(2000, 2) + "\n"
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-group", "g", "-stream", "s", "-create", "-retention", "5"},
+		strings.NewReader(input), &stdout, &stderr, factory)
+	if code != exitOk {
+		t.Fatalf("exit code: expected=%d got=%d stderr=%s", exitOk, code, stderr.String())
+	}
+
+	expectCalls := []string{"CreateLogGroup g", "PutRetentionPolicy g", "CreateLogStream s", "PutLogEvents s"}
+	if strings.Join(fake.calls, ",") != strings.Join(expectCalls, ",") {
+		t.Errorf("calls: expected=%v got=%v", expectCalls, fake.calls)
+	}
+	if len(fake.batches) != 1 || len(fake.batches[0]) != 3 ||
+		fake.batches[0][0] != 1000 || fake.batches[0][1] != 2000 || fake.batches[0][2] != 3000 {
+		t.Errorf("events not sorted chronologically: %v", fake.batches)
+	}
+
+	// latest datum holds the most recent value
+	fake.Require(t, emftest.Expect{
+		Namespace:  "ns",
+		Dimensions: map[string]string{"host": "a"},
+		Name:       "m",
+		Unit:       "Count",
+		Values:     []float64{3},
+	})
+
+	if got := stdout.String(); got != "sent 3 events in 1 batches to g/s\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+// go test -v -count 1 -run '^TestSendInvalid$' ./cmd/emf-send
+func TestSendInvalid(t *testing.T) {
+	factory := func(context.Context, options) (logsClient, error) {
+		t.Fatal("client must not be created for invalid input")
+		return nil, nil
+	}
+
+	input := emfLine(1000, 1) + "\nplain log line\n"
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-group", "g", "-stream", "s"},
+		strings.NewReader(input), &stdout, &stderr, factory)
+	if code != exitInvalid {
+		t.Fatalf("exit code: expected=%d got=%d", exitInvalid, code)
+	}
+	if !strings.HasPrefix(stderr.String(), "stdin:2: ") {
+		t.Errorf("missing line number: %s", stderr.String())
+	}
+
+	if code := run(context.Background(), nil, strings.NewReader(input), &stdout, &stderr, factory); code != exitError {
+		t.Errorf("missing group and stream: expected=%d got=%d", exitError, code)
+	}
+
+	// parsable, but rejected by the EMF specification
+	stderr.Reset()
+	spec := `{"_aws":{"Timestamp":1000,"CloudWatchMetrics":[{"Namespace":"","Dimensions":[],"Metrics":[{"Name":"m","Unit":"Foo"}]}]},"m":1}`
+	code = run(context.Background(), []string{"-group", "g", "-stream", "s", "-dry-run"},
+		strings.NewReader(spec+"\n"), &stdout, &stderr, factory)
+	if code != exitInvalid {
+		t.Errorf("invalid document: expected=%d got=%d", exitInvalid, code)
+	}
+	if !strings.Contains(stderr.String(), "Unit") {
+		t.Errorf("expected validation error: %s", stderr.String())
+	}
+}
+
+// go test -v -count 1 -run '^TestSendDryRun$' ./cmd/emf-send
+func TestSendDryRun(t *testing.T) {
+	factory := func(context.Context, options) (logsClient, error) {
+		t.Fatal("client must not be created for dry run")
+		return nil, nil
+	}
+
+	input := emfLine(1000, 1) + "\n" + emfLine(2000, 2) + "\n"
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-group", "g", "-stream", "s", "-dry-run"},
+		strings.NewReader(input), &stdout, &stderr, factory)
+	if code != exitOk {
+		t.Fatalf("exit code: expected=%d got=%d stderr=%s", exitOk, code, stderr.String())
+	}
+
+	out := stdout.String()
+	t.Logf("output:\n%s", out)
+	if !strings.Contains(out, "batch 1: events=2 ") || !strings.Contains(out, "first=1000 last=2000") {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+// go test -v -count 1 -run '^TestSendEndpointURL$' ./cmd/emf-send
+func TestSendEndpointURL(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", "/dev/null")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/dev/null")
+
+	var mutex sync.Mutex
+	var targets []string
+	var messages int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		targets = append(targets, r.Header.Get("X-Amz-Target"))
+		var input struct {
+			LogEvents []struct {
+				Message string `json:"message"`
+			} `json:"logEvents"`
+		}
+		json.Unmarshal(body, &input)
+		messages += len(input.LogEvents)
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	input := emfLine(1000, 1) + "\n" + emfLine(2000, 2) + "\n"
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(),
+		[]string{"-group", "g", "-stream", "s", "-region", "us-east-1", "-endpoint-url", server.URL},
+		strings.NewReader(input), &stdout, &stderr, newClient)
+	if code != exitOk {
+		t.Fatalf("exit code: expected=%d got=%d stderr=%s", exitOk, code, stderr.String())
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(targets) != 1 || targets[0] != "Logs_20140328.PutLogEvents" {
+		t.Errorf("unexpected requests: %v", targets)
+	}
+	if messages != 2 {
+		t.Errorf("messages: expected=2 got=%d", messages)
+	}
+}
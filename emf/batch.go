@@ -0,0 +1,56 @@
+package emf
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// PutLogEvents limits honored by BatchLogEvents.
+const (
+	MaxBatchEvents   = 10000          // events per PutLogEvents request
+	MaxBatchSize     = 1048576        // bytes per PutLogEvents request
+	LogEventOverhead = 26             // bytes added to each event message size
+	MaxBatchSpan     = 24 * time.Hour // time span of events in a request
+	maxBatchSpanMs   = int64(MaxBatchSpan / time.Millisecond)
+)
+
+// BatchLogEvents sorts events chronologically and splits them into
+// batches that each fit a single PutLogEvents request.
+// The events slice is not modified.
+// An event larger than MaxBatchSize is placed alone in its own batch,
+// for CloudWatch to reject.
+func BatchLogEvents(events []types.InputLogEvent) [][]types.InputLogEvent {
+	if len(events) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(events)
+	slices.SortStableFunc(sorted, func(a, b types.InputLogEvent) int {
+		return cmp.Compare(aws.ToInt64(a.Timestamp), aws.ToInt64(b.Timestamp))
+	})
+
+	var batches [][]types.InputLogEvent
+	var start, size int
+	var first int64
+
+	for i, e := range sorted {
+		t := aws.ToInt64(e.Timestamp)
+		eventSize := len(aws.ToString(e.Message)) + LogEventOverhead
+		if i > start && (i-start == MaxBatchEvents ||
+			size+eventSize > MaxBatchSize ||
+			t-first >= maxBatchSpanMs) {
+			batches = append(batches, sorted[start:i:i])
+			start, size = i, 0
+		}
+		if i == start {
+			first = t
+		}
+		size += eventSize
+	}
+
+	return append(batches, sorted[start:])
+}
@@ -0,0 +1,107 @@
+package emf
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+func newTestEvent(msg string, t int64) types.InputLogEvent {
+	return types.InputLogEvent{Message: aws.String(msg), Timestamp: aws.Int64(t)}
+}
+
+// go test -v -count 1 -run '^TestBatchLogEventsSort$' ./emf
+func TestBatchLogEventsSort(t *testing.T) {
+	events := []types.InputLogEvent{
+		newTestEvent("c", 3),
+		newTestEvent("a", 1),
+		newTestEvent("b1", 2),
+		newTestEvent("b2", 2),
+	}
+
+	batches := BatchLogEvents(events)
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch, got %d", len(batches))
+	}
+
+	var got []string
+	for _, e := range batches[0] {
+		got = append(got, aws.ToString(e.Message))
+	}
+	if strings.Join(got, ",") != "a,b1,b2,c" {
+		t.Errorf("unexpected order: %v", got)
+	}
+	if aws.ToString(events[0].Message) != "c" {
+		t.Errorf("input slice modified")
+	}
+
+	if BatchLogEvents(nil) != nil {
+		t.Errorf("expected no batches for no events")
+	}
+}
+
+// go test -v -count 1 -run '^TestBatchLogEventsLimits$' ./emf
+func TestBatchLogEventsLimits(t *testing.T) {
+	big := strings.Repeat("x", MaxBatchSize/4)
+	day := MaxBatchSpan.Milliseconds()
+
+	table := []struct {
+		name   string
+		events func() []types.InputLogEvent
+		sizes  []int
+	}{
+		{
+			name: "count",
+			events: func() []types.InputLogEvent {
+				var list []types.InputLogEvent
+				for range MaxBatchEvents + 1 {
+					list = append(list, newTestEvent("m", 0))
+				}
+				return list
+			},
+			sizes: []int{MaxBatchEvents, 1},
+		},
+		{
+			name: "size",
+			events: func() []types.InputLogEvent {
+				// 4 events exceed MaxBatchSize due to per-event overhead.
+				return []types.InputLogEvent{
+					newTestEvent(big, 0),
+					newTestEvent(big, 0),
+					newTestEvent(big, 0),
+					newTestEvent(big, 0),
+					newTestEvent(big, 0),
+				}
+			},
+			sizes: []int{3, 2},
+		},
+		{
+			name: "span",
+			events: func() []types.InputLogEvent {
+				return []types.InputLogEvent{
+					newTestEvent("m", 0),
+					newTestEvent("m", day-1),
+					newTestEvent("m", day),
+					newTestEvent("m", 2*day),
+				}
+			},
+			sizes: []int{2, 1, 1},
+		},
+	}
+
+	for _, data := range table {
+		t.Run(data.name, func(t *testing.T) {
+			batches := BatchLogEvents(data.events())
+			var sizes []int
+			for _, b := range batches {
+				sizes = append(sizes, len(b))
+			}
+			if !slices.Equal(sizes, data.sizes) {
+				t.Fatalf("batch sizes: expected=%v got=%v", data.sizes, sizes)
+			}
+		})
+	}
+}
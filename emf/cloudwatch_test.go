@@ -2,8 +2,6 @@ package emf
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -50,73 +48,26 @@ func (c *cloudWatchMock) PutLogEvents(_ context.Context,
 }
 
 func (c *cloudWatchMock) putOne(e types.InputLogEvent) error {
-	root := map[string]any{}
-	if err := json.Unmarshal([]byte(aws.ToString(e.Message)), &root); err != nil {
+	doc, err := Parse([]byte(aws.ToString(e.Message)))
+	if err != nil {
 		return err
 	}
-	meta, hasMeta := root["_aws"]
-	if !hasMeta {
-		return errors.New("missing metadata field _aws")
-	}
-	data, errJSON := json.Marshal(meta)
-	if errJSON != nil {
-		return fmt.Errorf("error metadata json marshal: %v", errJSON)
-	}
-	var metadata Metadata
-	if err := json.Unmarshal(data, &metadata); err != nil {
-		return err
-	}
-	for _, cwm := range metadata.CloudWatchMetrics {
-		if err := c.addMetricDirective(root, cwm); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func (c *cloudWatchMock) addMetricDirective(root map[string]any, cwm *MetricDirective) error {
-	namespaceName := cwm.Namespace
-	var namespaceDimensionsKeys DimensionSet
-	for _, set := range cwm.Dimensions {
-		namespaceDimensionsKeys = append(namespaceDimensionsKeys, set...)
-	}
-	namespaceDimensions := map[string]string{}
-	for _, key := range namespaceDimensionsKeys {
-		val, hasDim := root[key]
-		if !hasDim {
-			return fmt.Errorf("missing dimension value for: %s", key)
-		}
-		dimVal, isStr := val.(string)
-		if !isStr {
-			return fmt.Errorf("dimension value not a string: %s: %#T: %v", key, val, val)
-		}
-		namespaceDimensions[key] = dimVal
-	}
-	for _, def := range cwm.Metrics {
-		v, hasValue := root[def.Name]
-		if !hasValue {
-			return fmt.Errorf("missing metric value for: %s", def.Name)
-		}
-		val, isNum := v.(float64)
-		if !isNum {
-			return fmt.Errorf("metric value not a number: %s: %#T: %v", def.Name, v, v)
-		}
-		ns, foundNs := c.dim[namespaceName]
+	for _, d := range doc.Datums {
+		ns, foundNs := c.dim[d.Namespace]
 		if !foundNs {
 			ns = namespace{}
-			c.dim[namespaceName] = ns
+			c.dim[d.Namespace] = ns
 		}
-		dk := getDimensionKey(namespaceName, namespaceDimensions, namespaceDimensionsKeys)
+		dk := getDimensionKey(d.Namespace, d.Dimensions)
 		dim, foundDim := ns[dk]
 		if !foundDim {
 			dim = dimension{}
 			ns[dk] = dim
 		}
-		m := met{
-			definition: def,
-			value:      int(val),
+		dim[d.Metric.Name] = met{
+			definition: d.Metric,
+			value:      int(d.Values[0]),
 		}
-		dim[def.Name] = m
 	}
 	return nil
 }
@@ -137,11 +88,10 @@ func (c *cloudWatchMock) require(req requireMetric) error {
 	if !foundNs {
 		return fmt.Errorf("namespace not found: %s", req.namespace)
 	}
-	keys := getDimensionSet(req.dimensions)
-	dk := getDimensionKey(req.namespace, req.dimensions, keys)
+	dk := getDimensionKey(req.namespace, req.dimensions)
 	dim, foundDim := ns[dk]
 	if !foundDim {
-		return fmt.Errorf("dimensions not found: %v: %s", req.dimensions, dk)
+		return fmt.Errorf("dimensions not found: %v: %q", req.dimensions, dk)
 	}
 	m, foundMetric := dim[req.metricName]
 	if !foundMetric {
@@ -0,0 +1,39 @@
+package emf
+
+import "slices"
+
+// Collector records metrics into a Metric right before the metric is
+// rendered, like sampling a gauge on each flush.
+type Collector interface {
+	Collect(m *Metric)
+}
+
+// CollectorFunc adapts a function to Collector.
+type CollectorFunc func(m *Metric)
+
+// Collect calls f(m).
+func (f CollectorFunc) Collect(m *Metric) {
+	f(m)
+}
+
+// AddCollector registers c to be called before every render, that is,
+// by Render, WriteTo, Fprintln, Println, CloudWatchLogEvents and
+// CloudWatchString, and by Collect. Collectors are called in
+// registration order, and may call any Metric method other than those.
+func (m *Metric) AddCollector(c Collector) {
+	m.collectorsLock.Lock()
+	m.collectors = append(m.collectors, c)
+	m.collectorsLock.Unlock()
+}
+
+// Collect calls every registered collector, as rendering does. Code
+// reading Datums without ever rendering, like a Prometheus endpoint,
+// may call Collect before reading, to keep collector metrics current.
+func (m *Metric) Collect() {
+	m.collectorsLock.Lock()
+	collectors := slices.Clone(m.collectors)
+	m.collectorsLock.Unlock()
+	for _, c := range collectors {
+		c.Collect(m)
+	}
+}
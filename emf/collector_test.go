@@ -0,0 +1,62 @@
+package emf
+
+import (
+	"strings"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestCollector$' ./emf
+func TestCollector(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	var calls int
+	metric.AddCollector(CollectorFunc(func(m *Metric) {
+		calls++
+		m.Record("emf-test-ns1", MetricDefinition{Name: "collections"}, nil, calls)
+	}))
+
+	for i := 1; i <= 2; i++ {
+		list := metric.Render()
+		if len(list) != 1 || !strings.Contains(list[0], `"collections":`+string(rune('0'+i))) {
+			t.Fatalf("render %d: unexpected output: %v", i, list)
+		}
+	}
+
+	if datums := metric.Datums(); len(datums) != 1 || datums[0].Values[0] != 2 {
+		t.Fatalf("Datums must not collect: %v", datums)
+	}
+
+	var sb strings.Builder
+	metric.Fprintln(&sb)
+	if calls != 3 {
+		t.Errorf("expected 3 collections, got %d", calls)
+	}
+
+	metric.Collect()
+	if datums := metric.Datums(); calls != 4 || len(datums) != 1 || datums[0].Values[0] != 4 {
+		t.Errorf("expected Collect to collect: calls=%d datums=%v", calls, datums)
+	}
+}
+
+// go test -v -count 1 -run '^TestCollectorDatumsThenRender$' ./emf
+func TestCollectorDatumsThenRender(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }, SwapOnRender: true})
+
+	// collector draining events pending since the previous flush
+	var pending int
+	metric.AddCollector(CollectorFunc(func(m *Metric) {
+		m.Record("emf-test-ns1", MetricDefinition{Name: "events"}, nil, pending)
+		pending = 0
+	}))
+
+	pending += 3
+	metric.Datums() // like a scrape between flushes
+	pending += 2
+
+	list := metric.Render()
+	if len(list) != 1 || !strings.Contains(list[0], `"events":5`) {
+		t.Errorf("scrape must not drain pending events: %v", list)
+	}
+}
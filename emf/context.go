@@ -0,0 +1,25 @@
+package emf
+
+import "context"
+
+type scopeContextKey struct{}
+
+// noopScope is returned by FromContext when the context carries no scope.
+var noopScope = &Scope{}
+
+// NewContext returns a copy of ctx carrying the scope s.
+// Use FromContext to retrieve the scope deeper in the call stack.
+func NewContext(ctx context.Context, s *Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, s)
+}
+
+// FromContext returns the scope stored in ctx by NewContext.
+// If ctx carries no scope, FromContext returns a no-op scope that
+// silently discards every recorded metric, so callers never need
+// to check the result.
+func FromContext(ctx context.Context) *Scope {
+	if s, found := ctx.Value(scopeContextKey{}).(*Scope); found && s != nil {
+		return s
+	}
+	return noopScope
+}
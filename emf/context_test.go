@@ -0,0 +1,51 @@
+package emf
+
+import (
+	"context"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestContext$' ./emf
+func TestContext(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return 0 },
+		Namespace: "emf-test-ns1",
+	})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	ctx := NewContext(context.TODO(), metric.With(map[string]string{"Operation": "GetUser"}))
+
+	handler := func(ctx context.Context) {
+		FromContext(ctx).Record(metric1, 100)
+	}
+
+	handler(ctx)
+
+	const expect = `{"Operation":"GetUser","_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["Operation"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":100}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestContextMissingScope$' ./emf
+func TestContextMissingScope(t *testing.T) {
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	s := FromContext(context.TODO())
+
+	// must not panic
+	s.Record(metric1, 100)
+	s.With(map[string]string{"Operation": "GetUser"}).Record(metric1, 100)
+	s.Handle(metric1).Record(100)
+
+	var zero Scope
+	zero.Record(metric1, 100)
+}
@@ -2,13 +2,13 @@
 package emf
 
 import (
+	"bufio"
 	"encoding/json"
-	"fmt"
+	"hash/maphash"
 	"io"
 	"maps"
 	"os"
 	"slices"
-	"strings"
 	"sync"
 	"time"
 
@@ -18,14 +18,34 @@ import (
 
 // Metric holds full EMF metric context.
 type Metric struct {
-	table   map[string]*metricContext // dimensions => context
-	options Options
-	lock    sync.Mutex
+	shards         [shardCount]shard
+	seed           maphash.Seed
+	options        Options
+	collectors     []Collector
+	collectorsLock sync.Mutex
 }
 
+// shardCount is the number of table shards. Contexts are distributed
+// among shards by hash of dimension key, so that Record calls for
+// distinct contexts rarely contend for the same lock.
+const shardCount = 32
+
+// shard holds a partition of the metric table.
+type shard struct {
+	table      map[string]*metricContext // dimensions => context
+	generation uint64                    // bumped whenever contexts are dropped from table
+	lock       sync.Mutex
+}
+
+// metricContext holds metrics for one namespace and one set of dimensions.
+// meta holds exactly one MetricDirective: the context is removed when its
+// last metric is removed.
 type metricContext struct {
-	meta   *Metadata
-	values map[string]any
+	meta       *Metadata
+	values     map[string]value // metric name => value
+	namespace  string
+	dimensions map[string]string // immutable after creation
+	lastUpdate int64             // unix milli, only tracked when Options.TTL is defined
 }
 
 // Metadata defines EMF Metadata.
@@ -54,8 +74,39 @@ type MetricDefinition struct {
 // Options define options.
 type Options struct {
 	UnixMilli func() int64
+
+	// Namespace is the default namespace used by RecordDefault,
+	// HandleDefault and With. Empty Namespace defaults to
+	// DefaultNamespace, since CloudWatch drops metrics without namespace.
+	Namespace string
+
+	// TTL enables automatic expiry of stale contexts. A context (namespace
+	// plus dimensions) not updated by Record within TTL is evicted at render
+	// time. Zero TTL disables expiry.
+	TTL time.Duration
+
+	// OnEvict is an optional callback invoked for every context evicted
+	// due to TTL expiry.
+	OnEvict func(namespace string, dimensions map[string]string)
+
+	// SwapOnRender makes every render atomically hand the current values
+	// over to the renderer, leaving recorders with fresh empty values.
+	// Metric definitions carry over, but only metrics recorded since the
+	// previous render are rendered. Hence there is no need to call Reset
+	// between cycles.
+	SwapOnRender bool
+
+	// Properties are added as root members to every document, for
+	// context like service version. CloudWatch keeps properties in the
+	// log event without extracting them as metrics. Dimensions and
+	// metric values shadow properties with the same name.
+	Properties map[string]string
 }
 
+// DefaultNamespace is the default namespace used when Options.Namespace
+// is left undefined.
+const DefaultNamespace = "aws-emf"
+
 // DefaultUnixMilli is default function used when Options.UnixMilli is left undefined.
 func DefaultUnixMilli() int64 {
 	return time.Now().UnixMilli()
@@ -66,8 +117,13 @@ func New(options Options) *Metric {
 	if options.UnixMilli == nil {
 		options.UnixMilli = DefaultUnixMilli
 	}
+	if options.Namespace == "" {
+		options.Namespace = DefaultNamespace
+	}
+	options.Properties = maps.Clone(options.Properties)
 	m := &Metric{
 		options: options,
+		seed:    maphash.MakeSeed(),
 	}
 	m.Reset()
 	return m
@@ -77,149 +133,375 @@ func New(options Options) *Metric {
 // If in the previsou cycle you sent any metric what you won't update
 // with Record() in the next cycle, use Reset() to clear all metrics
 // before the next cycle. Otherwise those stale metrics will be sent again.
+// Alternatively, define Options.TTL to automatically evict only the
+// contexts that stopped being updated.
 func (m *Metric) Reset() {
-	m.lock.Lock()
-	m.table = map[string]*metricContext{}
-	m.lock.Unlock()
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.lock.Lock()
+		sh.table = map[string]*metricContext{}
+		sh.generation++
+		sh.lock.Unlock()
+	}
 }
 
-// Record records a metric.
-func (m *Metric) Record(namespace string, metric MetricDefinition, dimensions map[string]string, value int) {
-	m.lock.Lock()
-	c := m.defineMetric(namespace, metric, dimensions)
-	c.values[metric.Name] = value
-	for k, v := range dimensions {
-		c.values[k] = v
+// getShard returns the shard holding dimKey.
+func (m *Metric) getShard(dimKey []byte) *shard {
+	return &m.shards[maphash.Bytes(m.seed, dimKey)%shardCount]
+}
+
+// RemoveMetric removes a single metric from the context identified by
+// namespace and dimensions. If the context is left without metrics,
+// the context itself is removed. RemoveMetric reports whether the metric
+// was found.
+func (m *Metric) RemoveMetric(namespace, metricName string, dimensions map[string]string) bool {
+	var kb keyBuffer
+	dimKey, _ := kb.compute(namespace, dimensions)
+	sh := m.getShard(dimKey)
+
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	c, foundContext := sh.table[string(dimKey)]
+	if !foundContext {
+		return false
+	}
+
+	dir := c.meta.CloudWatchMetrics[0]
+	index := slices.IndexFunc(dir.Metrics, func(md MetricDefinition) bool { return md.Name == metricName })
+	if index < 0 {
+		return false
 	}
-	m.lock.Unlock()
+
+	dir.Metrics = slices.Delete(dir.Metrics, index, index+1)
+	delete(c.values, metricName)
+
+	if len(dir.Metrics) == 0 {
+		delete(sh.table, string(dimKey))
+	}
+
+	sh.generation++
+
+	return true
 }
 
-func getDimensionKey(namespace string, dimensions map[string]string, dimSet DimensionSet) string {
-	var list []string
-	slices.Sort(dimSet)
-	for _, k := range dimSet {
-		v := dimensions[k]
-		list = append(list, fmt.Sprintf("%s:%s", k, v))
+// RemoveDimensions removes the context identified by namespace and
+// dimensions, with all of its metrics. RemoveDimensions reports whether
+// the context was found.
+func (m *Metric) RemoveDimensions(namespace string, dimensions map[string]string) bool {
+	var kb keyBuffer
+	dimKey, _ := kb.compute(namespace, dimensions)
+	sh := m.getShard(dimKey)
+
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	if _, foundContext := sh.table[string(dimKey)]; !foundContext {
+		return false
 	}
-	return namespace + " " + strings.Join(list, ",")
+
+	delete(sh.table, string(dimKey))
+	sh.generation++
+
+	return true
 }
 
-func getDimensionSet(dimensions map[string]string) DimensionSet {
-	return slices.Collect(maps.Keys(dimensions))
+// RemoveNamespace removes all contexts under namespace.
+// RemoveNamespace returns the number of contexts removed.
+func (m *Metric) RemoveNamespace(namespace string) int {
+	var removed int
+	for i := range m.shards {
+		removed += m.shards[i].removeNamespace(namespace)
+	}
+	return removed
 }
 
-func (m *Metric) getContext(namespace string, dimensions map[string]string) (*metricContext, DimensionSet) {
-	dimSet := getDimensionSet(dimensions)
-	dimKey := getDimensionKey(namespace, dimensions, dimSet)
-	c, foundContext := m.table[dimKey]
-	if !foundContext {
-		c = &metricContext{
-			meta:   &Metadata{},
-			values: map[string]any{},
+func (sh *shard) removeNamespace(namespace string) int {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	var removed int
+	for dimKey, c := range sh.table {
+		if c.namespace == namespace {
+			delete(sh.table, dimKey)
+			removed++
 		}
-		m.table[dimKey] = c
 	}
-	return c, dimSet
+
+	if removed > 0 {
+		sh.generation++
+	}
+
+	return removed
 }
 
-// defineMetric defines a metric.
-func (m *Metric) defineMetric(namespace string, metric MetricDefinition, dimensions map[string]string) *metricContext {
-	//
-	// get context
-	//
-	c, dimSet := m.getContext(namespace, dimensions)
+// Record records a metric.
+func (m *Metric) Record(namespace string, metric MetricDefinition, dimensions map[string]string, value int) {
+	m.record(namespace, metric, dimensions, intValue(value))
+}
 
-	var dimSetList []DimensionSet
-	if len(dimSet) == 0 {
-		dimSetList = []DimensionSet{}
-	} else {
-		dimSetList = []DimensionSet{dimSet}
+// RecordFloat records a metric with a float value.
+// NaN and infinite values, which EMF cannot represent, are ignored.
+func (m *Metric) RecordFloat(namespace string, metric MetricDefinition, dimensions map[string]string, value float64) {
+	if !finite(value) {
+		return
 	}
+	m.record(namespace, metric, dimensions, floatValue(value))
+}
 
-	//
-	// define metric
-	//
-	var directive *MetricDirective
-	var foundDir bool
-	for _, dir := range c.meta.CloudWatchMetrics {
-		if namespace == dir.Namespace {
-			directive = dir
-			foundDir = true
-			break
-		}
+// RecordValues records a metric with an array of values, as for
+// distributions of observations. CloudWatch computes statistics,
+// like percentiles, over all values. Only the first MaxValuesPerMetric
+// values are kept, and NaN and infinite values are ignored. Recording
+// no values is ignored.
+func (m *Metric) RecordValues(namespace string, metric MetricDefinition, dimensions map[string]string, values []float64) {
+	v := arrayValue(values)
+	if len(v.values) == 0 {
+		return
 	}
-	if foundDir {
-		var foundMetric bool
-		var index int
-		for i, md := range directive.Metrics {
-			if md.Name == metric.Name {
-				foundMetric = true
-				index = i
-				break
-			}
-		}
-		if foundMetric {
-			directive.Metrics[index] = metric
-		} else {
-			directive.Metrics = append(directive.Metrics, metric)
-		}
+	m.record(namespace, metric, dimensions, v)
+}
 
-		//
-		// define dimensions
-		//
-		directive.Dimensions = dimSetList
+func (m *Metric) record(namespace string, metric MetricDefinition, dimensions map[string]string, v value) {
+	var kb keyBuffer
+	dimKey, keys := kb.compute(namespace, dimensions)
+	sh := m.getShard(dimKey)
+	sh.lock.Lock()
+	c := sh.getContext(namespace, dimensions, dimKey, keys)
+	c.defineMetric(metric)
+	c.values[metric.Name] = v
+	m.touch(c)
+	sh.lock.Unlock()
+}
 
-	} else {
-		dir := &MetricDirective{
-			Namespace: namespace,
-			Metrics:   []MetricDefinition{metric},
-		}
+// RecordDefault records a metric into the default namespace Options.Namespace.
+// Use Record to record a metric into any other namespace.
+func (m *Metric) RecordDefault(metric MetricDefinition, dimensions map[string]string, value int) {
+	m.Record(m.options.Namespace, metric, dimensions, value)
+}
 
-		//
-		// define dimensions
-		//
-		dir.Dimensions = dimSetList
+// getContext finds the context for dimKey, creating it if needed.
+// dimKey and keys must have been computed by keyBuffer.compute from
+// namespace and dimensions. Looking up an existing context does not
+// allocate.
+// Caller must hold sh.lock.
+func (sh *shard) getContext(namespace string, dimensions map[string]string, dimKey []byte, keys []string) *metricContext {
+	if c, foundContext := sh.table[string(dimKey)]; foundContext {
+		return c
+	}
 
-		c.meta.CloudWatchMetrics = append(c.meta.CloudWatchMetrics, dir)
+	dimSetList := []DimensionSet{}
+	if len(keys) > 0 {
+		dimSetList = []DimensionSet{slices.Clone(keys)}
 	}
 
+	c := &metricContext{
+		meta: &Metadata{
+			CloudWatchMetrics: []*MetricDirective{
+				{
+					Namespace:  namespace,
+					Dimensions: dimSetList,
+				},
+			},
+		},
+		values:     map[string]value{},
+		namespace:  namespace,
+		dimensions: maps.Clone(dimensions),
+	}
+	sh.table[string(dimKey)] = c
 	return c
 }
 
+// defineMetric defines a metric in the context directive.
+// Caller must hold the context shard lock.
+func (c *metricContext) defineMetric(metric MetricDefinition) {
+	dir := c.meta.CloudWatchMetrics[0]
+	for i, md := range dir.Metrics {
+		if md.Name == metric.Name {
+			dir.Metrics[i] = metric
+			return
+		}
+	}
+	dir.Metrics = append(dir.Metrics, metric)
+}
+
 func (m *Metric) count() (metrics, dimensions int) {
-	for _, c := range m.table {
-		for _, md := range c.meta.CloudWatchMetrics {
-			metrics += len(md.Metrics)
-			dimensions += len(md.Dimensions)
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.lock.Lock()
+		for _, c := range sh.table {
+			for _, md := range c.meta.CloudWatchMetrics {
+				metrics += len(md.Metrics)
+				dimensions += len(md.Dimensions)
+			}
 		}
+		sh.lock.Unlock()
 	}
 	return
 }
 
 // Render renders metrics as string.
 func (m *Metric) Render() []string {
-	t := m.options.UnixMilli()
-	return m.renderWithTimestamp(t)
+	var list []string
+	m.encode(m.options.UnixMilli(), func(line []byte) error {
+		list = append(list, string(trimNewline(line)))
+		return nil
+	})
+	return list
 }
 
-func (m *Metric) renderWithTimestamp(t int64) []string {
-	m.lock.Lock()
-	list := make([]string, 0, len(m.table))
-	for _, c := range m.table {
-		c.meta.Timestamp = t
-		c.values["_aws"] = c.meta
-		data, _ := json.Marshal(c.values)
-		list = append(list, string(data))
+// touch records the update time of the context for TTL expiry.
+// Caller must hold the context shard lock.
+func (m *Metric) touch(c *metricContext) {
+	if m.options.TTL > 0 {
+		c.lastUpdate = m.options.UnixMilli()
+	}
+}
+
+// expire removes contexts not updated within ttl (milliseconds) from the
+// shard, appending them to evicted.
+// Caller must hold sh.lock.
+func (sh *shard) expire(t, ttl int64, evicted []*metricContext) []*metricContext {
+	var found bool
+	for dimKey, c := range sh.table {
+		if t-c.lastUpdate > ttl {
+			delete(sh.table, dimKey)
+			evicted = append(evicted, c)
+			found = true
+		}
+	}
+	if found {
+		sh.generation++
+	}
+	return evicted
+}
+
+// notifyEvicted invokes the OnEvict callback.
+// Caller must NOT hold any shard lock, so that the callback is free to use m.
+func (m *Metric) notifyEvicted(evicted []*metricContext) {
+	if m.options.OnEvict == nil {
+		return
+	}
+	for _, c := range evicted {
+		m.options.OnEvict(c.namespace, maps.Clone(c.dimensions))
+	}
+}
+
+// contextSnapshot is a copy of metricContext detached from the table,
+// hence it can be rendered without holding any lock.
+type contextSnapshot struct {
+	meta       *Metadata
+	values     map[string]value
+	dimensions map[string]string
+	properties map[string]string
+}
+
+// snapshot takes a copy of the table for rendering. Only the copy is
+// performed under the shard locks, the expensive JSON marshaling is left
+// to the caller. If Options.SwapOnRender is set, values are handed over
+// to the snapshot and the table retains empty values.
+// Every shard is copied atomically, one shard at a time.
+func (m *Metric) snapshot(t int64) []contextSnapshot {
+	var list []contextSnapshot
+	var evicted []*metricContext
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.lock.Lock()
+		if m.options.TTL > 0 {
+			evicted = sh.expire(t, m.options.TTL.Milliseconds(), evicted)
+		}
+		for _, c := range sh.table {
+			var values map[string]value
+			if m.options.SwapOnRender {
+				values = c.values
+				if len(values) == 0 {
+					continue // nothing recorded since previous render
+				}
+				c.values = map[string]value{}
+			} else {
+				values = maps.Clone(c.values)
+			}
+			list = append(list, contextSnapshot{
+				meta:       cloneMetadata(c.meta, values, t),
+				values:     values,
+				dimensions: c.dimensions,
+				properties: m.options.Properties,
+			})
+		}
+		sh.lock.Unlock()
+	}
+	m.notifyEvicted(evicted)
+	return list
+}
+
+// Datums returns the current value of every recorded metric, one datum
+// per metric and dimensions. Contexts older than Options.TTL are left
+// out. Unlike rendering, Datums neither takes values in SwapOnRender
+// mode, evicts contexts nor calls collectors, hence it does not disturb
+// values waiting for the next flush. See Collect to run collectors.
+func (m *Metric) Datums() []Datum {
+	t := m.options.UnixMilli()
+	ttl := m.options.TTL.Milliseconds()
+	var list []Datum
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.lock.Lock()
+		for _, c := range sh.table {
+			if ttl > 0 && t-c.lastUpdate > ttl {
+				continue // expired, evicted by next render
+			}
+			for _, dir := range c.meta.CloudWatchMetrics {
+				for _, md := range dir.Metrics {
+					v, found := c.values[md.Name]
+					if !found {
+						continue
+					}
+					list = append(list, Datum{
+						Namespace:  c.namespace,
+						Dimensions: maps.Clone(c.dimensions),
+						Metric:     md,
+						Values:     v.float64s(),
+						Array:      v.kind == valueArray,
+						Timestamp:  t,
+					})
+				}
+			}
+		}
+		sh.lock.Unlock()
 	}
-	m.lock.Unlock()
 	return list
 }
 
+// cloneMetadata copies meta keeping only metrics with values.
+func cloneMetadata(meta *Metadata, values map[string]value, t int64) *Metadata {
+	clone := &Metadata{
+		CloudWatchMetrics: make([]*MetricDirective, 0, len(meta.CloudWatchMetrics)),
+		Timestamp:         t,
+	}
+	for _, dir := range meta.CloudWatchMetrics {
+		metrics := make([]MetricDefinition, 0, len(dir.Metrics))
+		for _, md := range dir.Metrics {
+			if _, found := values[md.Name]; found {
+				metrics = append(metrics, md)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		clone.CloudWatchMetrics = append(clone.CloudWatchMetrics, &MetricDirective{
+			Namespace:  dir.Namespace,
+			Dimensions: slices.Clone(dir.Dimensions),
+			Metrics:    metrics,
+		})
+	}
+	return clone
+}
+
 // Fprintln yields EMF metric to Writer.
 func (m *Metric) Fprintln(w io.Writer) {
-	for _, item := range m.Render() {
-		fmt.Fprintln(w, item)
-	}
+	bw := bufio.NewWriter(w)
+	m.WriteTo(bw)
+	bw.Flush()
 }
 
 // Println yields EMF metric to stdout.
@@ -230,25 +512,25 @@ func (m *Metric) Println() {
 // CloudWatchLogEvents yields EMF metric as input for cloudwatch log events.
 func (m *Metric) CloudWatchLogEvents() []types.InputLogEvent {
 	t := m.options.UnixMilli()
-	list := m.renderWithTimestamp(t)
 	var eventList []types.InputLogEvent
-	for _, m := range list {
+	m.encode(t, func(line []byte) error {
 		eventList = append(eventList, types.InputLogEvent{
-			Message:   aws.String(m),
+			Message:   aws.String(string(trimNewline(line))),
 			Timestamp: aws.Int64(t),
 		})
-	}
+		return nil
+	})
 	return eventList
 }
 
 // CloudWatchString yields EMF metric as cloudwatch string for aws cli.
 func (m *Metric) CloudWatchString() string {
 	t := m.options.UnixMilli()
-	list := m.renderWithTimestamp(t)
 	var cwList []entry
-	for _, m := range list {
-		cwList = append(cwList, newEntry(m, t))
-	}
+	m.encode(t, func(line []byte) error {
+		cwList = append(cwList, newEntry(string(trimNewline(line)), t))
+		return nil
+	})
 	data, _ := json.Marshal(cwList)
 	return string(data)
 }
@@ -4,8 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 )
@@ -828,6 +835,511 @@ func TestSameMetricWithoutDimensionsWithDistinctNamespaces(t *testing.T) {
 	}
 }
 
+// go test -v -count 1 -run '^TestRecordDefaultNamespace$' ./emf
+func TestRecordDefaultNamespace(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return 0 },
+		Namespace: "emf-test-default",
+	})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric.RecordDefault(metric1, nil, 100)
+	list := metric.Render()
+	data := list[0]
+
+	t.Logf("output: %s", data)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-default","Dimensions":[],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":100}`
+	if expect != data {
+		t.Fatalf("expected=%s got=%s", expect, data)
+	}
+
+	// explicit namespace is still available
+	metric.Record("emf-test-ns1", metric1, nil, 50)
+	if list := metric.Render(); len(list) != 2 {
+		t.Fatalf("list size: expected=2 got=%d", len(list))
+	}
+}
+
+// go test -v -count 1 -run '^TestRecordDefaultNamespaceUnset$' ./emf
+func TestRecordDefaultNamespaceUnset(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	metric1 := MetricDefinition{Name: "speed1"}
+
+	metric.RecordDefault(metric1, nil, 1)
+	metric.HandleDefault(MetricDefinition{Name: "speed2"}, nil).Record(2)
+	metric.With(map[string]string{"dimKey1": "dimVal1"}).Record(metric1, 3)
+
+	list := metric.Render()
+	if len(list) != 2 {
+		t.Fatalf("list size: expected=2 got=%d", len(list))
+	}
+	for _, data := range list {
+		if err := Validate([]byte(data)); err != nil {
+			t.Errorf("invalid document: %v: %s", err, data)
+		}
+		if !strings.Contains(data, `"Namespace":"`+DefaultNamespace+`"`) {
+			t.Errorf("expected default namespace: %s", data)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestRemoveMetric$' ./emf
+func TestRemoveMetric(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric2 := MetricDefinition{
+		Name: "speed2",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric2, dim1, 50)
+
+	if metric.RemoveMetric("emf-test-ns1", "speed3", dim1) {
+		t.Fatalf("removed non-existing metric")
+	}
+	if metric.RemoveMetric("emf-test-ns1", "speed1", nil) {
+		t.Fatalf("removed metric from non-existing context")
+	}
+
+	if !metric.RemoveMetric("emf-test-ns1", "speed1", dim1) {
+		t.Fatalf("metric not removed")
+	}
+
+	{
+		const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["dimKey1"]],"Metrics":[{"Name":"speed2"}]}],"Timestamp":0},"dimKey1":"dimVal1","speed2":50}`
+		list := metric.Render()
+		if len(list) != 1 || list[0] != expect {
+			t.Fatalf("expected=%s got=%v", expect, list)
+		}
+	}
+
+	if !metric.RemoveMetric("emf-test-ns1", "speed2", dim1) {
+		t.Fatalf("metric not removed")
+	}
+
+	if list := metric.Render(); len(list) != 0 {
+		t.Fatalf("context without metrics must be removed: %v", list)
+	}
+}
+
+// go test -v -count 1 -run '^TestRemoveMetricWithHandle$' ./emf
+func TestRemoveMetricWithHandle(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric2 := MetricDefinition{
+		Name: "speed2",
+	}
+
+	h := metric.Handle("emf-test-ns1", metric1, nil)
+	h.Record(100)
+	metric.Record("emf-test-ns1", metric2, nil, 50)
+
+	metric.RemoveMetric("emf-test-ns1", "speed1", nil)
+
+	// handle must define its metric again
+	h.Record(200)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[],"Metrics":[{"Name":"speed2"},{"Name":"speed1"}]}],"Timestamp":0},"speed1":200,"speed2":50}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestRemoveDimensions$' ./emf
+func TestRemoveDimensions(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	dim1 := map[string]string{"host": "host1"}
+	dim2 := map[string]string{"host": "host2"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric1, dim2, 200)
+
+	if metric.RemoveDimensions("emf-test-ns2", dim1) {
+		t.Fatalf("removed context from wrong namespace")
+	}
+	if !metric.RemoveDimensions("emf-test-ns1", dim1) {
+		t.Fatalf("context not removed")
+	}
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["host"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"host":"host2","speed1":200}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestRemoveNamespace$' ./emf
+func TestRemoveNamespace(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	dim1 := map[string]string{"host": "host1"}
+	dim2 := map[string]string{"host": "host2"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric1, dim2, 200)
+	metric.Record("emf-test-ns2", metric1, dim1, 300)
+
+	if removed := metric.RemoveNamespace("emf-test-ns1"); removed != 2 {
+		t.Fatalf("removed: expected=2 got=%d", removed)
+	}
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns2","Dimensions":[["host"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"host":"host1","speed1":300}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestTTL$' ./emf
+func TestTTL(t *testing.T) {
+
+	var now int64
+
+	type evictedContext struct {
+		namespace  string
+		dimensions map[string]string
+	}
+	var evicted []evictedContext
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return now },
+		TTL:       10 * time.Second,
+		OnEvict: func(namespace string, dimensions map[string]string) {
+			evicted = append(evicted, evictedContext{namespace, dimensions})
+		},
+	})
+
+	dim1 := map[string]string{"host": "host1"}
+	dim2 := map[string]string{"host": "host2"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric1, dim2, 200)
+
+	now = 5000
+	metric.Record("emf-test-ns1", metric1, dim2, 201)
+
+	now = 10000 // host1 is exactly at TTL, not expired yet
+	if list := metric.Render(); len(list) != 2 {
+		t.Fatalf("list size: expected=2 got=%d", len(list))
+	}
+	if len(evicted) != 0 {
+		t.Fatalf("unexpected eviction: %v", evicted)
+	}
+
+	now = 10001 // host1 expired
+	list := metric.Render()
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["host"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":10001},"host":"host2","speed1":201}`
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+
+	if len(evicted) != 1 {
+		t.Fatalf("evicted: expected=1 got=%d", len(evicted))
+	}
+	if evicted[0].namespace != "emf-test-ns1" || evicted[0].dimensions["host"] != "host1" {
+		t.Fatalf("wrong context evicted: %v", evicted[0])
+	}
+}
+
+// go test -v -count 1 -run '^TestTTLWithHandle$' ./emf
+func TestTTLWithHandle(t *testing.T) {
+
+	var now int64
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return now },
+		TTL:       time.Second,
+	})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	h := metric.Handle("emf-test-ns1", metric1, nil)
+	h.Record(100)
+
+	now = 2000
+	if list := metric.Render(); len(list) != 0 {
+		t.Fatalf("expected expired context: %v", list)
+	}
+
+	h.Record(200)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[],"Metrics":[{"Name":"speed1"}]}],"Timestamp":2000},"speed1":200}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestSwapOnRender$' ./emf
+func TestSwapOnRender(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli:    func() int64 { return 0 },
+		SwapOnRender: true,
+	})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric2 := MetricDefinition{
+		Name: "speed2",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric2, dim1, 50)
+
+	{
+		const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["dimKey1"]],"Metrics":[{"Name":"speed1"},{"Name":"speed2"}]}],"Timestamp":0},"dimKey1":"dimVal1","speed1":100,"speed2":50}`
+		list := metric.Render()
+		if len(list) != 1 || list[0] != expect {
+			t.Fatalf("expected=%s got=%v", expect, list)
+		}
+	}
+
+	// values were handed over to previous render
+	if list := metric.Render(); len(list) != 0 {
+		t.Fatalf("expected no values after swap: %v", list)
+	}
+
+	// definitions carry over, only recorded metric is rendered
+	metric.Record("emf-test-ns1", metric2, dim1, 51)
+
+	{
+		const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["dimKey1"]],"Metrics":[{"Name":"speed2"}]}],"Timestamp":0},"dimKey1":"dimVal1","speed2":51}`
+		list := metric.Render()
+		if len(list) != 1 || list[0] != expect {
+			t.Fatalf("expected=%s got=%v", expect, list)
+		}
+	}
+}
+
+// go test -race -count 1 -run '^TestSwapOnRenderRace$' ./emf
+func TestSwapOnRenderRace(t *testing.T) {
+
+	metric := New(Options{SwapOnRender: true})
+
+	metric1 := MetricDefinition{
+		Name: "metric1",
+	}
+
+	h := metric.Handle("emf-test-ns1", metric1, nil)
+
+	const recorders = 100
+
+	var wg sync.WaitGroup
+
+	for range recorders {
+		wg.Add(1)
+		go func() {
+			for i := range 100 {
+				h.Record(i)
+				metric.Record("emf-test-ns1", metric1, map[string]string{"dimKey1": "dimVal1"}, i)
+			}
+			wg.Done()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		for _, data := range metric.Render() {
+			if found, err := hasMeta([]byte(data)); !found {
+				t.Fatalf("bad render: %s: %v", data, err)
+			}
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestDatums$' ./emf
+func TestDatums(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli:    func() int64 { return 5 },
+		SwapOnRender: true,
+	})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := MetricDefinition{Name: "speed1", Unit: "Count"}
+	metric2 := MetricDefinition{Name: "speed2", StorageResolution: 1}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns2", metric2, nil, 50)
+
+	for range 2 {
+		// Datums must not take values from swap mode
+		datums := metric.Datums()
+		if len(datums) != 2 {
+			t.Fatalf("expected 2 datums, got %d: %v", len(datums), datums)
+		}
+		slices.SortFunc(datums, func(a, b Datum) int { return strings.Compare(a.Namespace, b.Namespace) })
+
+		d := datums[0]
+		if d.Namespace != "emf-test-ns1" || d.Metric != metric1 || d.Dimensions["dimKey1"] != "dimVal1" ||
+			!slices.Equal(d.Values, []float64{100}) || d.Timestamp != 5 {
+			t.Errorf("unexpected datum: %+v", d)
+		}
+		d = datums[1]
+		if d.Namespace != "emf-test-ns2" || d.Metric != metric2 || len(d.Dimensions) != 0 ||
+			!slices.Equal(d.Values, []float64{50}) {
+			t.Errorf("unexpected datum: %+v", d)
+		}
+	}
+
+	if list := metric.Render(); len(list) != 2 {
+		t.Errorf("expected values kept for render: %v", list)
+	}
+}
+
+// go test -v -count 1 -run '^TestDatumsArray$' ./emf
+func TestDatumsArray(t *testing.T) {
+
+	metric := New(Options{})
+
+	metric.Record("emf-test-ns1", MetricDefinition{Name: "scalar"}, nil, 1)
+	metric.RecordValues("emf-test-ns1", MetricDefinition{Name: "array"}, nil, []float64{1})
+
+	for _, d := range metric.Datums() {
+		if d.Array != (d.Metric.Name == "array") {
+			t.Errorf("unexpected array kind: %+v", d)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestDatumsTTL$' ./emf
+func TestDatumsTTL(t *testing.T) {
+
+	var now int64
+
+	var evicted int
+	metric := New(Options{
+		UnixMilli: func() int64 { return now },
+		TTL:       10 * time.Second,
+		OnEvict:   func(string, map[string]string) { evicted++ },
+	})
+
+	metric1 := MetricDefinition{Name: "speed1"}
+
+	metric.Record("emf-test-ns1", metric1, map[string]string{"host": "host1"}, 100)
+	now = 5000
+	metric.Record("emf-test-ns1", metric1, map[string]string{"host": "host2"}, 200)
+
+	now = 10001 // host1 expired
+	datums := metric.Datums()
+	if len(datums) != 1 || datums[0].Dimensions["host"] != "host2" {
+		t.Fatalf("expected only host2, got %v", datums)
+	}
+	if evicted != 0 {
+		t.Errorf("Datums must not evict, got %d evictions", evicted)
+	}
+}
+
+// go test -v -count 1 -run '^TestRecordFloatAndValues$' ./emf
+func TestRecordFloatAndValues(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	metric1 := MetricDefinition{Name: "ratio", Unit: "Percent"}
+	metric2 := MetricDefinition{Name: "latency", Unit: "Milliseconds"}
+
+	metric.RecordFloat("emf-test-ns1", metric1, nil, 0.25)
+	metric.RecordFloat("emf-test-ns1", metric1, nil, math.NaN()) // ignored
+	metric.RecordValues("emf-test-ns1", metric2, nil, []float64{1.5, math.Inf(1), 3})
+	metric.RecordValues("emf-test-ns1", MetricDefinition{Name: "empty"}, nil, nil) // ignored
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[],"Metrics":[{"Name":"ratio","Unit":"Percent"},{"Name":"latency","Unit":"Milliseconds"}]}],"Timestamp":0},"latency":[1.5,3],"ratio":0.25}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+	if err := Validate([]byte(list[0])); err != nil {
+		t.Fatalf("invalid EMF: %v", err)
+	}
+
+	many := make([]float64, 2*MaxValuesPerMetric)
+	metric.RecordValues("emf-test-ns1", metric2, nil, many)
+	for _, d := range metric.Datums() {
+		if d.Metric.Name == metric2.Name && len(d.Values) != MaxValuesPerMetric {
+			t.Errorf("expected values truncated to %d, got %d", MaxValuesPerMetric, len(d.Values))
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestProperties$' ./emf
+func TestProperties(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli:  func() int64 { return 0 },
+		Properties: map[string]string{"version": "1.2.3", "host": "shadowed"},
+	})
+
+	metric.Record("emf-test-ns1", MetricDefinition{Name: "speed1"}, map[string]string{"host": "a"}, 1)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["host"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"host":"a","speed1":1,"version":"1.2.3"}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+
+	doc, err := Parse([]byte(list[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Properties["version"] != "1.2.3" || len(doc.Datums) != 1 {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+}
+
 // go test -v -count 1 -run '^TestCloudWatchSendExample$' ./emf
 func TestCloudWatchSendExample(t *testing.T) {
 
@@ -951,3 +1463,73 @@ func TestRace(_ *testing.T) {
 
 	wg.Wait()
 }
+
+// go test -race -count 1 -run '^TestConcurrentRecordMatchesSequential$' ./emf
+func TestConcurrentRecordMatchesSequential(t *testing.T) {
+
+	const (
+		goroutines = 64
+		hosts      = 50
+	)
+
+	metric1 := MetricDefinition{
+		Name: "metric1",
+		Unit: "Count",
+	}
+
+	metric2 := MetricDefinition{
+		Name: "metric2",
+	}
+
+	record := func(metric *Metric, g int) {
+		for h := range hosts {
+			dim := map[string]string{"host": fmt.Sprintf("host%d", h), "worker": fmt.Sprintf("worker%d", g)}
+			metric.Record("emf-test-ns1", metric1, dim, g*hosts+h)
+			metric.Record("emf-test-ns1", metric2, dim, h)
+			metric.Record("emf-test-ns2", metric1, map[string]string{"host": fmt.Sprintf("host%d", h)}, h)
+		}
+	}
+
+	sequential := New(Options{UnixMilli: func() int64 { return 0 }})
+	for g := range goroutines {
+		record(sequential, g)
+	}
+
+	concurrent := New(Options{UnixMilli: func() int64 { return 0 }})
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			record(concurrent, g)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	expect := sequential.Render()
+	got := concurrent.Render()
+	slices.Sort(expect)
+	slices.Sort(got)
+
+	if len(got) != goroutines*hosts+hosts {
+		t.Fatalf("list size: expected=%d got=%d", goroutines*hosts+hosts, len(got))
+	}
+	if !slices.Equal(expect, got) {
+		t.Fatalf("concurrent render differs from sequential render")
+	}
+}
+
+// go test -bench '^BenchmarkRecordParallel$' -benchmem -run '^$' ./emf
+func BenchmarkRecordParallel(b *testing.B) {
+	metric := New(Options{})
+	metric1 := MetricDefinition{Name: "speed1"}
+	var worker atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		dim := map[string]string{"worker": strconv.FormatInt(worker.Add(1), 10)}
+		var i int
+		for pb.Next() {
+			metric.Record("emf-test-ns1", metric1, dim, i)
+			i++
+		}
+	})
+}
@@ -0,0 +1,358 @@
+// Package emfgather bridges Prometheus client_golang registries to EMF.
+//
+// Bridge gathers a prometheus.Gatherer and records the gathered metrics
+// into an emf.Metric, so that code instrumented with Prometheus
+// collectors reaches CloudWatch through EMF without a scraping agent.
+// Registered as an emf.Collector, the bridge gathers on every flush:
+//
+//	metric.AddCollector(emfgather.New(prometheus.DefaultGatherer, emfgather.Options{Namespace: "my-app"}))
+//
+// Metrics are mapped as follows:
+//
+//   - Gauges and untyped metrics record their current value.
+//   - Counters record the increase since the previous gather, with unit
+//     Count. The first gather records the full value.
+//   - Histograms record the observations since the previous gather as
+//     an EMF value array built from bucket counts, plus name_count and
+//     name_sum increases. Without new observations the array is left
+//     out.
+//   - Gauge histograms record their current buckets, count and sum.
+//   - Summaries record each quantile under dimension "quantile", plus
+//     name_count and name_sum increases.
+//
+// Labels become dimensions.
+package emfgather
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/internal/delta"
+	"github.com/udhos/aws-emf/emf/internal/serieskey"
+)
+
+// Options define bridge options.
+type Options struct {
+	// Namespace is the EMF namespace for metrics not mapped by a rule.
+	// Empty Namespace defaults to emf.DefaultNamespace.
+	Namespace string
+
+	// Dimensions are added to every metric, like service name.
+	// Metric labels take precedence over them.
+	Dimensions map[string]string
+
+	// Rules map metric families to EMF. The first rule matching a family
+	// applies to it.
+	Rules []Rule
+
+	// OnError is an optional callback invoked with gather errors when the
+	// bridge runs as a collector. Metrics gathered despite errors are
+	// still recorded.
+	OnError func(err error)
+}
+
+// Rule maps metric families to EMF.
+type Rule struct {
+	// Match selects metric families by name. Nil matches every family.
+	Match *regexp.Regexp
+
+	// Drop skips matching families.
+	Drop bool
+
+	// Namespace overrides Options.Namespace.
+	Namespace string
+
+	// Unit is the EMF unit. Empty Unit is inferred from the name suffix,
+	// like Seconds for _seconds and Bytes for _bytes.
+	Unit string
+
+	// StorageResolution is the EMF storage resolution.
+	StorageResolution int
+
+	// Labels lists the labels kept as dimensions. Nil keeps all labels.
+	// Series differing only by dropped labels are summed, except for
+	// gauge and untyped values and summary quantiles, where the last
+	// series wins.
+	Labels []string
+}
+
+// Bridge records metrics gathered from a prometheus.Gatherer into
+// an emf.Metric. A Bridge is safe for concurrent use.
+type Bridge struct {
+	gatherer prometheus.Gatherer
+	options  Options
+	deltas   *delta.Tracker[seriesKey] // series => last cumulative value
+	lock     sync.Mutex
+}
+
+// New creates a Bridge.
+func New(gatherer prometheus.Gatherer, options Options) *Bridge {
+	options.Namespace = cmp.Or(options.Namespace, emf.DefaultNamespace)
+	return &Bridge{
+		gatherer: gatherer,
+		options:  options,
+		deltas:   delta.New[seriesKey](),
+	}
+}
+
+// Collect gathers metrics into m, reporting errors to Options.OnError.
+// Collect implements emf.Collector.
+func (b *Bridge) Collect(m *emf.Metric) {
+	if err := b.Gather(m); err != nil && b.options.OnError != nil {
+		b.options.OnError(err)
+	}
+}
+
+// Gather gathers metrics and records them into m.
+// Metrics gathered despite an error are still recorded.
+func (b *Bridge) Gather(m *emf.Metric) error {
+	families, err := b.gatherer.Gather()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, f := range families {
+		rule := b.findRule(f.GetName())
+		if rule.Drop {
+			continue
+		}
+		b.recordFamily(m, f, rule)
+	}
+
+	if err == nil {
+		b.deltas.Sweep() // forget vanished series
+	}
+
+	return err
+}
+
+func (b *Bridge) findRule(name string) Rule {
+	for _, r := range b.options.Rules {
+		if r.Match == nil || r.Match.MatchString(name) {
+			if r.Namespace == "" {
+				r.Namespace = b.options.Namespace
+			}
+			return r
+		}
+	}
+	return Rule{Namespace: b.options.Namespace}
+}
+
+func (b *Bridge) recordFamily(m *emf.Metric, f *dto.MetricFamily, rule Rule) {
+	name := f.GetName()
+	unit := cmp.Or(rule.Unit, inferUnit(name))
+	if f.GetType() == dto.MetricType_COUNTER {
+		unit = cmp.Or(unit, "Count")
+	}
+	md := emf.MetricDefinition{Name: name, Unit: unit, StorageResolution: rule.StorageResolution}
+
+	aggregates := map[string]*aggregate{} // dimensions key => aggregate
+	for _, metric := range f.GetMetric() {
+		dims := b.dimensions(metric.GetLabel(), rule.Labels)
+		id := serieskey.Key(dims)
+		a, found := aggregates[id]
+		if !found {
+			a = &aggregate{
+				dimensions: dims,
+				quantiles:  map[float64]float64{},
+				buckets:    map[float64]uint64{},
+			}
+			aggregates[id] = a
+		}
+		b.accumulate(a, f.GetType(), seriesKey{series: seriesID(name, metric.GetLabel())}, metric)
+	}
+
+	for _, a := range aggregates {
+		a.record(m, rule.Namespace, md, f.GetType())
+	}
+}
+
+// aggregate accumulates the series of a family sharing dimensions, that
+// is differing only by labels dropped by Rule.Labels.
+type aggregate struct {
+	dimensions map[string]string
+	value      float64             // gauge, untyped or counter
+	quantiles  map[float64]float64 // summary quantile => value
+	buckets    map[float64]uint64  // histogram bucket upper bound => count
+	count, sum float64             // histogram or summary
+}
+
+// accumulate adds a series to its aggregate. Counters, histograms, and
+// summary counts and sums are summed, while the last series wins for
+// gauge and untyped values and for summary quantiles.
+// Caller must hold b.lock.
+func (b *Bridge) accumulate(a *aggregate, t dto.MetricType, key seriesKey, metric *dto.Metric) {
+	switch t {
+	case dto.MetricType_GAUGE:
+		a.value = metric.GetGauge().GetValue()
+	case dto.MetricType_UNTYPED:
+		a.value = metric.GetUntyped().GetValue()
+	case dto.MetricType_COUNTER:
+		a.value += b.deltas.Delta(key, metric.GetCounter().GetValue())
+	case dto.MetricType_HISTOGRAM:
+		b.accumulateHistogram(a, key, metric.GetHistogram(), true)
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		b.accumulateHistogram(a, key, metric.GetHistogram(), false)
+	case dto.MetricType_SUMMARY:
+		s := metric.GetSummary()
+		for _, q := range s.GetQuantile() {
+			a.quantiles[q.GetQuantile()] = q.GetValue()
+		}
+		a.count += b.deltas.Delta(key.with("count"), float64(s.GetSampleCount()))
+		a.sum += b.deltas.Delta(key.with("sum"), s.GetSampleSum())
+	}
+}
+
+// accumulateHistogram adds histogram bucket counts, count and sum to a:
+// increases since the previous gather if cumulative, current values
+// otherwise.
+// Caller must hold b.lock.
+func (b *Bridge) accumulateHistogram(a *aggregate, key seriesKey, h *dto.Histogram, cumulative bool) {
+	buckets := h.GetBucket()
+	var below float64 // cumulative increase of lower buckets
+	for _, bucket := range buckets {
+		upper := bucket.GetUpperBound()
+		le := b.sample(cumulative, key.with("le="+strconv.FormatFloat(upper, 'g', -1, 64)),
+			float64(bucket.GetCumulativeCount()))
+		a.buckets[upper] += uint64(max(le-below, 0))
+		below = max(le, below)
+	}
+	if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].GetUpperBound(), 1) {
+		// implicit +Inf bucket
+		total := b.sample(cumulative, key.with("le=+Inf"), float64(h.GetSampleCount()))
+		a.buckets[math.Inf(1)] += uint64(max(total-below, 0))
+	}
+	a.count += b.sample(cumulative, key.with("count"), float64(h.GetSampleCount()))
+	a.sum += b.sample(cumulative, key.with("sum"), h.GetSampleSum())
+}
+
+// record records the aggregate into m.
+func (a *aggregate) record(m *emf.Metric, ns string, md emf.MetricDefinition, t dto.MetricType) {
+	switch t {
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		if values := a.histogramValues(); len(values) == 0 {
+			// no observations: drop the previous array, which a metric
+			// not in SwapOnRender mode would render again
+			m.RemoveMetric(ns, md.Name, a.dimensions)
+		} else {
+			m.RecordValues(ns, md, a.dimensions, values)
+		}
+		a.recordCountSum(m, ns, md)
+	case dto.MetricType_SUMMARY:
+		for q, v := range a.quantiles {
+			qDims := maps.Clone(a.dimensions)
+			qDims["quantile"] = strconv.FormatFloat(q, 'g', -1, 64)
+			m.RecordFloat(ns, md, qDims, v)
+		}
+		a.recordCountSum(m, ns, md)
+	default:
+		m.RecordFloat(ns, md, a.dimensions, a.value)
+	}
+}
+
+func (a *aggregate) recordCountSum(m *emf.Metric, ns string, md emf.MetricDefinition) {
+	m.RecordFloat(ns, countDefinition(md), a.dimensions, a.count)
+	m.RecordFloat(ns, sumDefinition(md), a.dimensions, a.sum)
+}
+
+// histogramValues expands the bucket counts into EMF values.
+func (a *aggregate) histogramValues() []float64 {
+	uppers := slices.Sorted(maps.Keys(a.buckets))
+	boundaries := append([]float64{math.Inf(-1)}, uppers...)
+	counts := make([]uint64, len(uppers))
+	for i, upper := range uppers {
+		counts[i] = a.buckets[upper]
+	}
+	return emf.HistogramValues(boundaries, counts)
+}
+
+// sample returns the increase of a cumulative value since the previous
+// gather, or value itself if not cumulative.
+// Caller must hold b.lock.
+func (b *Bridge) sample(cumulative bool, key seriesKey, value float64) float64 {
+	if !cumulative {
+		return value
+	}
+	return b.deltas.Delta(key, value)
+}
+
+func countDefinition(md emf.MetricDefinition) emf.MetricDefinition {
+	return emf.MetricDefinition{Name: md.Name + "_count", Unit: "Count", StorageResolution: md.StorageResolution}
+}
+
+func sumDefinition(md emf.MetricDefinition) emf.MetricDefinition {
+	return emf.MetricDefinition{Name: md.Name + "_sum", Unit: md.Unit, StorageResolution: md.StorageResolution}
+}
+
+// dimensions maps labels to dimensions, keeping only the labels listed
+// in keep, unless keep is nil.
+func (b *Bridge) dimensions(labels []*dto.LabelPair, keep []string) map[string]string {
+	dims := maps.Clone(b.options.Dimensions)
+	if dims == nil {
+		dims = map[string]string{}
+	}
+	for _, l := range labels {
+		if keep == nil || slices.Contains(keep, l.GetName()) {
+			dims[l.GetName()] = l.GetValue()
+		}
+	}
+	return dims
+}
+
+// seriesKey identifies a cumulative series, or part of it like a bucket.
+type seriesKey struct {
+	series string // family name and labels, see seriesID
+	part   string
+}
+
+func (k seriesKey) with(part string) seriesKey {
+	k.part = part
+	return k
+}
+
+// seriesID identifies a series by family name and labels, which the
+// gatherer returns sorted by name.
+func seriesID(name string, labels []*dto.LabelPair) string {
+	b := serieskey.AppendString(nil, name)
+	for _, l := range labels {
+		b = serieskey.AppendString(b, l.GetName())
+		b = serieskey.AppendString(b, l.GetValue())
+	}
+	return string(b)
+}
+
+// unitSuffixes maps Prometheus base unit suffixes to EMF units.
+var unitSuffixes = []struct {
+	suffix string
+	unit   string
+}{
+	{"_seconds", "Seconds"},
+	{"_bytes", "Bytes"},
+	{"_bits", "Bits"},
+	{"_percent", "Percent"},
+	{"_total", "Count"},
+}
+
+// inferUnit infers the EMF unit from the metric name suffix, ignoring
+// a trailing _total, like Bytes for http_response_bytes_total.
+func inferUnit(name string) string {
+	base := strings.TrimSuffix(name, "_total")
+	for _, u := range unitSuffixes {
+		if strings.HasSuffix(base, u.suffix) {
+			return u.unit
+		}
+	}
+	if base != name {
+		return "Count"
+	}
+	return ""
+}
@@ -0,0 +1,305 @@
+package emfgather
+
+import (
+	"errors"
+	"maps"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/udhos/aws-emf/emf"
+)
+
+func findDatum(t *testing.T, datums []emf.Datum, name string, dims map[string]string) emf.Datum {
+	t.Helper()
+	for _, d := range datums {
+		if d.Metric.Name == name && maps.Equal(d.Dimensions, dims) {
+			return d
+		}
+	}
+	t.Fatalf("datum not found: %s %v", name, dims)
+	return emf.Datum{}
+}
+
+// go test -v -count 1 -run '^TestBridge$' ./emf/emfgather
+func TestBridge(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Buckets: []float64{0.1, 1},
+	})
+	registry.MustRegister(requests, inFlight, latency)
+
+	metric := emf.New(emf.Options{UnixMilli: func() int64 { return 0 }})
+	bridge := New(registry, Options{
+		Namespace:  "my-app",
+		Dimensions: map[string]string{"service": "api"},
+	})
+
+	requests.WithLabelValues("200").Add(5)
+	inFlight.Set(2.5)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(2)
+
+	dims := map[string]string{"service": "api"}
+	dims200 := map[string]string{"service": "api", "code": "200"}
+
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	datums := metric.Datums()
+
+	d := findDatum(t, datums, "requests_total", dims200)
+	if d.Namespace != "my-app" || d.Metric.Unit != "Count" || d.Values[0] != 5 {
+		t.Errorf("unexpected counter: %+v", d)
+	}
+	d = findDatum(t, datums, "in_flight", dims)
+	if d.Metric.Unit != "" || d.Values[0] != 2.5 {
+		t.Errorf("unexpected gauge: %+v", d)
+	}
+	d = findDatum(t, datums, "latency_seconds", dims)
+	if d.Metric.Unit != "Seconds" || !slices.Equal(d.Values, []float64{0.1, 0.55, 1}) {
+		t.Errorf("unexpected histogram: %+v", d)
+	}
+	if d := findDatum(t, datums, "latency_seconds_count", dims); d.Values[0] != 3 {
+		t.Errorf("unexpected histogram count: %+v", d)
+	}
+
+	// second gather records increases only
+	requests.WithLabelValues("200").Add(1)
+	latency.Observe(0.5)
+
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	datums = metric.Datums()
+
+	if d := findDatum(t, datums, "requests_total", dims200); d.Values[0] != 1 {
+		t.Errorf("expected counter increase 1, got %v", d.Values)
+	}
+	if d := findDatum(t, datums, "latency_seconds", dims); !slices.Equal(d.Values, []float64{0.55}) {
+		t.Errorf("expected one new observation, got %v", d.Values)
+	}
+	if d := findDatum(t, datums, "latency_seconds_sum", dims); d.Values[0] != 0.5 {
+		t.Errorf("expected sum increase 0.5, got %v", d.Values)
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeRules$' ./emf/emfgather
+func TestBridgeRules(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	size := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "queue_size"}, []string{"queue", "pod"})
+	ignored := prometheus.NewGauge(prometheus.GaugeOpts{Name: "debug_gauge"})
+	registry.MustRegister(size, ignored)
+
+	size.WithLabelValues("q1", "pod-123").Set(7)
+	ignored.Set(1)
+
+	metric := emf.New(emf.Options{})
+	bridge := New(registry, Options{
+		Namespace: "my-app",
+		Rules: []Rule{
+			{Match: regexp.MustCompile(`^debug_`), Drop: true},
+			{Match: regexp.MustCompile(`^queue_`), Namespace: "queues", Unit: "Count", Labels: []string{"queue"}},
+		},
+	})
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+
+	datums := metric.Datums()
+	if len(datums) != 1 {
+		t.Fatalf("expected only queue_size, got %v", datums)
+	}
+	d := datums[0]
+	if d.Namespace != "queues" || d.Metric.Unit != "Count" ||
+		!maps.Equal(d.Dimensions, map[string]string{"queue": "q1"}) || d.Values[0] != 7 {
+		t.Errorf("unexpected datum: %+v", d)
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeOnError$' ./emf/emfgather
+func TestBridgeOnError(t *testing.T) {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, errors.New("gather failed")
+	})
+
+	var reported error
+	metric := emf.New(emf.Options{})
+	metric.AddCollector(New(gatherer, Options{OnError: func(err error) { reported = err }}))
+	metric.Render()
+
+	if reported == nil {
+		t.Errorf("expected error reported")
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeHistogramIdle$' ./emf/emfgather
+func TestBridgeHistogramIdle(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{1}})
+	registry.MustRegister(latency)
+
+	metric := emf.New(emf.Options{}) // values are not swapped on render
+	bridge := New(registry, Options{})
+
+	latency.Observe(0.5)
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	findDatum(t, metric.Datums(), "latency_seconds", map[string]string{})
+
+	// no new observations
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range metric.Datums() {
+		if d.Metric.Name == "latency_seconds" {
+			t.Errorf("previous observations must not be sent again: %+v", d)
+		}
+	}
+	if d := findDatum(t, metric.Datums(), "latency_seconds_count", map[string]string{}); d.Values[0] != 0 {
+		t.Errorf("expected count increase 0, got %v", d.Values)
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeGaugeHistogram$' ./emf/emfgather
+func TestBridgeGaugeHistogram(t *testing.T) {
+	gaugeHistogram := dto.MetricType_GAUGE_HISTOGRAM
+	name := "queue_age_seconds"
+	upper, cumulative := 10.0, uint64(2)
+	count, sum := uint64(3), 25.0
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{{
+			Name: &name,
+			Type: &gaugeHistogram,
+			Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+				SampleCount: &count,
+				SampleSum:   &sum,
+				Bucket:      []*dto.Bucket{{UpperBound: &upper, CumulativeCount: &cumulative}},
+			}}},
+		}}, nil
+	})
+
+	metric := emf.New(emf.Options{})
+	bridge := New(gatherer, Options{})
+
+	// the same current state must be recorded on every gather
+	for i := range 2 {
+		if err := bridge.Gather(metric); err != nil {
+			t.Fatal(err)
+		}
+		datums := metric.Datums()
+		if d := findDatum(t, datums, name, map[string]string{}); !slices.Equal(d.Values, []float64{10, 10, 10}) {
+			t.Errorf("gather %d: unexpected values: %v", i, d.Values)
+		}
+		if d := findDatum(t, datums, name+"_count", map[string]string{}); d.Values[0] != 3 {
+			t.Errorf("gather %d: unexpected count: %v", i, d.Values)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeDefaultNamespace$' ./emf/emfgather
+func TestBridgeDefaultNamespace(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight"})
+	registry.MustRegister(gauge)
+	gauge.Set(1)
+
+	metric := emf.New(emf.Options{})
+	metric.AddCollector(New(registry, Options{}))
+
+	lines := metric.Render()
+	if len(lines) == 0 {
+		t.Fatal("expected documents")
+	}
+	for _, line := range lines {
+		if err := emf.Validate([]byte(line)); err != nil {
+			t.Errorf("invalid document: %v: %s", err, line)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeSeriesKey$' ./emf/emfgather
+func TestBridgeSeriesKey(t *testing.T) {
+	counter := dto.MetricType_COUNTER
+	name := "requests_total"
+	label := func(name, value string) *dto.LabelPair { return &dto.LabelPair{Name: &name, Value: &value} }
+	value := func(v float64) *dto.Counter { return &dto.Counter{Value: &v} }
+
+	// both would join as "a=b\x00c=d" with naive separators
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{{
+			Name: &name,
+			Type: &counter,
+			Metric: []*dto.Metric{
+				{Label: []*dto.LabelPair{label("a", "b\x00c=d")}, Counter: value(5)},
+				{Label: []*dto.LabelPair{label("a", "b"), label("c", "d")}, Counter: value(7)},
+			},
+		}}, nil
+	})
+
+	metric := emf.New(emf.Options{})
+	if err := New(gatherer, Options{}).Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+
+	datums := metric.Datums()
+	if d := findDatum(t, datums, name, map[string]string{"a": "b\x00c=d"}); d.Values[0] != 5 {
+		t.Errorf("unexpected first series: %+v", d)
+	}
+	if d := findDatum(t, datums, name, map[string]string{"a": "b", "c": "d"}); d.Values[0] != 7 {
+		t.Errorf("unexpected second series: %+v", d)
+	}
+}
+
+// go test -v -count 1 -run '^TestBridgeDroppedLabels$' ./emf/emfgather
+func TestBridgeDroppedLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"route", "pod"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{1}},
+		[]string{"route", "pod"})
+	registry.MustRegister(requests, latency)
+
+	metric := emf.New(emf.Options{})
+	bridge := New(registry, Options{Rules: []Rule{{Labels: []string{"route"}}}})
+	dims := map[string]string{"route": "/a"}
+
+	requests.WithLabelValues("/a", "pod-1").Add(3)
+	requests.WithLabelValues("/a", "pod-2").Add(4)
+	latency.WithLabelValues("/a", "pod-1").Observe(0.5)
+	latency.WithLabelValues("/a", "pod-2").Observe(2)
+
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	datums := metric.Datums()
+	if d := findDatum(t, datums, "requests_total", dims); d.Values[0] != 7 {
+		t.Errorf("expected series summed, got %+v", d)
+	}
+	if d := findDatum(t, datums, "latency_seconds", dims); !slices.Equal(d.Values, []float64{1, 1}) {
+		t.Errorf("expected histograms merged, got %+v", d)
+	}
+	if d := findDatum(t, datums, "latency_seconds_count", dims); d.Values[0] != 2 {
+		t.Errorf("expected counts summed, got %+v", d)
+	}
+
+	// increases of every series are kept
+	requests.WithLabelValues("/a", "pod-1").Add(1)
+	requests.WithLabelValues("/a", "pod-2").Add(2)
+
+	if err := bridge.Gather(metric); err != nil {
+		t.Fatal(err)
+	}
+	if d := findDatum(t, metric.Datums(), "requests_total", dims); d.Values[0] != 3 {
+		t.Errorf("expected increases summed, got %+v", d)
+	}
+}
@@ -0,0 +1,171 @@
+// Package emfhttp records net/http metrics into EMF.
+//
+// NewHandler wraps an http.Handler to record server metrics:
+//
+//	handler := emfhttp.NewHandler(metric, mux, emfhttp.HandlerOptions{Namespace: "my-app"})
+//
+// NewTransport wraps an http.RoundTripper to record client metrics:
+//
+//	client := &http.Client{Transport: emfhttp.NewTransport(metric, nil, emfhttp.TransportOptions{Namespace: "my-app"})}
+//
+// Requests are aggregated between flushes, and recorded into the
+// metric by a collector registered on it. A series without requests
+// since the previous flush is recorded once more with zero counts and
+// no latency, then forgotten, so metrics both in and out of
+// emf.Options.SwapOnRender mode never render stale values.
+package emfhttp
+
+import (
+	"math/rand/v2"
+	"sync"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/internal/serieskey"
+)
+
+// aggregator accumulates observations per series between flushes.
+type aggregator struct {
+	series map[string]*series // series key => series
+	lock   sync.Mutex
+}
+
+// series holds the observations of a dimension set since last flush.
+type series struct {
+	dimensions map[string]string
+	requests   int
+	errors     int
+	retries    int
+	reqBytes   int
+	respBytes  int
+	latency    []float64 // reservoir sample of latencies
+}
+
+// observation is one request.
+type observation struct {
+	latency   float64 // milliseconds
+	err       bool
+	retry     bool
+	reqBytes  int
+	respBytes int
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{series: map[string]*series{}}
+}
+
+// observe adds o to the series for dims.
+func (a *aggregator) observe(dims map[string]string, o observation) {
+	key := seriesKey(dims)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	s, found := a.series[key]
+	if !found {
+		s = &series{dimensions: dims}
+		a.series[key] = s
+	}
+
+	s.requests++
+	if o.err {
+		s.errors++
+	}
+	if o.retry {
+		s.retries++
+	}
+	s.reqBytes += o.reqBytes
+	s.respBytes += o.respBytes
+
+	// reservoir sampling keeps latencies representative when there
+	// are more requests than EMF values per metric
+	if len(s.latency) < emf.MaxValuesPerMetric {
+		s.latency = append(s.latency, o.latency)
+	} else if i := rand.IntN(s.requests); i < emf.MaxValuesPerMetric {
+		s.latency[i] = o.latency
+	}
+}
+
+// flush hands the series over and starts a new interval. Series idle
+// during the interval are handed over with zero counts, then forgotten.
+func (a *aggregator) flush() []*series {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	list := make([]*series, 0, len(a.series))
+	for key, s := range a.series {
+		list = append(list, s)
+		if s.requests == 0 {
+			delete(a.series, key)
+			continue
+		}
+		a.series[key] = &series{dimensions: s.dimensions}
+	}
+	return list
+}
+
+// recordValues records values, or removes the metric if there are none,
+// so that a metric not in SwapOnRender mode does not render the values
+// of a previous flush.
+func recordValues(m *emf.Metric, ns string, md emf.MetricDefinition, dims map[string]string, values []float64) {
+	if len(values) == 0 {
+		m.RemoveMetric(ns, md.Name, dims)
+		return
+	}
+	m.RecordValues(ns, md, dims, values)
+}
+
+// seriesKey identifies dims.
+func seriesKey(dims map[string]string) string {
+	return serieskey.Key(dims)
+}
+
+// guard limits the distinct values of a dimension. Values beyond the
+// limit are replaced by other.
+type guard struct {
+	limit int
+	other string
+	seen  map[string]struct{}
+	lock  sync.Mutex
+}
+
+func newGuard(limit int, other string) *guard {
+	return &guard{limit: limit, other: other, seen: map[string]struct{}{}}
+}
+
+// value returns v, or g.other if v would exceed the limit.
+func (g *guard) value(v string) string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, found := g.seen[v]; found {
+		return v
+	}
+	if len(g.seen) >= g.limit {
+		return g.other
+	}
+	g.seen[v] = struct{}{}
+	return v
+}
+
+// methods are the standard methods kept as dimension values.
+var methods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+// methodValue guards the method dimension against arbitrary methods.
+func methodValue(method string) string {
+	if method == "" {
+		return "GET"
+	}
+	if methods[method] {
+		return method
+	}
+	return "OTHER"
+}
+
+// statusClass returns the status class, like "2xx" for 200.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return string(rune('0'+status/100)) + "xx"
+}
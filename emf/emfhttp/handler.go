@@ -0,0 +1,276 @@
+package emfhttp
+
+import (
+	"bufio"
+	"cmp"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+// Server dimensions selectable in HandlerOptions.RequestDimensions.
+const (
+	DimensionRoute       = "route"        // route pattern, like "GET /users/{id}"
+	DimensionMethod      = "method"       // request method
+	DimensionStatusClass = "status_class" // response status class, like "2xx"
+)
+
+// Server metrics.
+var (
+	metricServerRequests      = emf.MetricDefinition{Name: "http_server_requests", Unit: "Count"}
+	metricServerLatency       = emf.MetricDefinition{Name: "http_server_latency", Unit: "Milliseconds"}
+	metricServerRequestBytes  = emf.MetricDefinition{Name: "http_server_request_bytes", Unit: "Bytes"}
+	metricServerResponseBytes = emf.MetricDefinition{Name: "http_server_response_bytes", Unit: "Bytes"}
+	metricServerInFlight      = emf.MetricDefinition{Name: "http_server_in_flight", Unit: "Count"}
+)
+
+// HandlerOptions define server middleware options.
+type HandlerOptions struct {
+	// Namespace is the EMF namespace.
+	// Empty Namespace defaults to emf.DefaultNamespace.
+	Namespace string
+
+	// Dimensions are added to every metric, like service name.
+	Dimensions map[string]string
+
+	// RequestDimensions selects the per-request dimensions among
+	// DimensionRoute, DimensionMethod and DimensionStatusClass.
+	// Nil selects all of them.
+	RequestDimensions []string
+
+	// Route returns the route of a request, after it has been served.
+	// Nil defaults to the pattern matched by http.ServeMux, or
+	// "unmatched".
+	Route func(r *http.Request) string
+
+	// MaxRoutes limits distinct routes. Further routes are recorded as
+	// "other". Zero defaults to 100.
+	MaxRoutes int
+}
+
+// handler records server metrics around next.
+type handler struct {
+	next       http.Handler
+	options    HandlerOptions
+	aggregator *aggregator
+	routes     *guard
+	inFlight   atomic.Int64
+}
+
+// NewHandler wraps next to record, per route, method and status class:
+// request count, latency, request and response bytes. It also records
+// the requests in flight with the static dimensions only. Metrics are
+// recorded on every flush of m.
+func NewHandler(m *emf.Metric, next http.Handler, options HandlerOptions) http.Handler {
+	options.Namespace = cmp.Or(options.Namespace, emf.DefaultNamespace)
+	if options.RequestDimensions == nil {
+		options.RequestDimensions = []string{DimensionRoute, DimensionMethod, DimensionStatusClass}
+	}
+	if options.Route == nil {
+		options.Route = defaultRoute
+	}
+	h := &handler{
+		next:       next,
+		options:    options,
+		aggregator: newAggregator(),
+		routes:     newGuard(cmp.Or(options.MaxRoutes, 100), "other"),
+	}
+	m.AddCollector(h)
+	return h
+}
+
+func defaultRoute(r *http.Request) string {
+	return cmp.Or(r.Pattern, "unmatched")
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.inFlight.Add(1)
+	defer h.inFlight.Add(-1)
+
+	begin := time.Now()
+
+	body := &countingReader{ReadCloser: r.Body}
+	if r.Body != nil {
+		r.Body = body
+	}
+	rw := &responseWriter{ResponseWriter: w}
+
+	h.next.ServeHTTP(rw.wrap(), r)
+
+	elapsed := time.Since(begin)
+
+	h.aggregator.observe(h.dimensions(r, rw.statusCode()), observation{
+		latency:   float64(elapsed) / float64(time.Millisecond),
+		reqBytes:  max(int(r.ContentLength), body.n),
+		respBytes: rw.n,
+	})
+}
+
+// dimensions returns the dimensions of a served request.
+func (h *handler) dimensions(r *http.Request, status int) map[string]string {
+	dims := maps.Clone(h.options.Dimensions)
+	if dims == nil {
+		dims = map[string]string{}
+	}
+	for _, d := range h.options.RequestDimensions {
+		switch d {
+		case DimensionRoute:
+			dims[d] = h.routes.value(h.options.Route(r))
+		case DimensionMethod:
+			dims[d] = methodValue(r.Method)
+		case DimensionStatusClass:
+			dims[d] = statusClass(status)
+		}
+	}
+	return dims
+}
+
+// Collect records the requests served since the previous flush.
+// Collect implements emf.Collector.
+func (h *handler) Collect(m *emf.Metric) {
+	ns := h.options.Namespace
+	m.Record(ns, metricServerInFlight, h.options.Dimensions, int(h.inFlight.Load()))
+	for _, s := range h.aggregator.flush() {
+		m.Record(ns, metricServerRequests, s.dimensions, s.requests)
+		recordValues(m, ns, metricServerLatency, s.dimensions, s.latency)
+		m.Record(ns, metricServerRequestBytes, s.dimensions, s.reqBytes)
+		m.Record(ns, metricServerResponseBytes, s.dimensions, s.respBytes)
+	}
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.ReadCloser.Read(p)
+	cr.n += n
+	return n, err
+}
+
+// responseWriter captures the status and counts the bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	n      int
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 && status >= 200 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(p)
+	rw.n += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, for
+// flushing and deadlines.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// wrap returns rw implementing the optional interfaces http.Flusher,
+// http.Hijacker and io.ReaderFrom that the underlying writer
+// implements, for streaming and websocket handlers.
+func (rw *responseWriter) wrap() http.ResponseWriter {
+	_, isFlusher := rw.ResponseWriter.(http.Flusher)
+	_, isHijacker := rw.ResponseWriter.(http.Hijacker)
+	_, isReaderFrom := rw.ResponseWriter.(io.ReaderFrom)
+
+	f, h, r := flusher{rw}, hijacker{rw}, readerFrom{rw}
+
+	switch {
+	case isFlusher && isHijacker && isReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+			readerFrom
+		}{rw, f, h, r}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			flusher
+			hijacker
+		}{rw, f, h}
+	case isFlusher && isReaderFrom:
+		return struct {
+			*responseWriter
+			flusher
+			readerFrom
+		}{rw, f, r}
+	case isHijacker && isReaderFrom:
+		return struct {
+			*responseWriter
+			hijacker
+			readerFrom
+		}{rw, h, r}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			flusher
+		}{rw, f}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			hijacker
+		}{rw, h}
+	case isReaderFrom:
+		return struct {
+			*responseWriter
+			readerFrom
+		}{rw, r}
+	}
+	return rw
+}
+
+type flusher struct{ rw *responseWriter }
+
+func (f flusher) Flush() {
+	if f.rw.status == 0 {
+		f.rw.status = http.StatusOK
+	}
+	f.rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijacker struct{ rw *responseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h.rw.status == 0 {
+		h.rw.status = http.StatusSwitchingProtocols
+	}
+	return h.rw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type readerFrom struct{ rw *responseWriter }
+
+func (r readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	if r.rw.status == 0 {
+		r.rw.status = http.StatusOK
+	}
+	n, err := r.rw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	r.rw.n += int(n)
+	return n, err
+}
+
+// statusCode returns the status sent, which is 200 if the handler
+// wrote nothing.
+func (rw *responseWriter) statusCode() int {
+	return cmp.Or(rw.status, http.StatusOK)
+}
@@ -0,0 +1,188 @@
+package emfhttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/emftest"
+)
+
+func serve(h http.Handler, method, target, body string) {
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, strings.NewReader(body)))
+}
+
+// go test -v -count 1 -run '^TestHandler$' ./emf/emfhttp
+func TestHandler(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad", http.StatusBadRequest)
+	})
+
+	handler := NewHandler(metric, mux, HandlerOptions{
+		Namespace:  "my-app",
+		Dimensions: map[string]string{"service": "users"},
+	})
+
+	serve(handler, "GET", "/users/1", "")
+	serve(handler, "GET", "/users/2", "")
+	serve(handler, "POST", "/users", "payload")
+	serve(handler, "GET", "/missing", "")
+
+	metric.WriteTo(cw)
+
+	get := map[string]string{"service": "users", "route": "GET /users/{id}", "method": "GET", "status_class": "2xx"}
+	post := map[string]string{"service": "users", "route": "POST /users", "method": "POST", "status_class": "4xx"}
+	missing := map[string]string{"service": "users", "route": "unmatched", "method": "GET", "status_class": "4xx"}
+
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: get, Name: "http_server_requests", Unit: "Count", Values: []float64{2}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: get, Name: "http_server_response_bytes", Unit: "Bytes", Values: []float64{10}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: post, Name: "http_server_requests", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: post, Name: "http_server_request_bytes", Unit: "Bytes", Values: []float64{7}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: missing, Name: "http_server_requests", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: map[string]string{"service": "users"},
+		Name: "http_server_in_flight", Unit: "Count", Values: []float64{0}})
+
+	if latency, _ := cw.Find("my-app", get, "http_server_latency"); len(latency.Values) != 2 {
+		t.Errorf("expected 2 latencies, got %+v", latency)
+	}
+
+	// next flush holds only new requests
+	cw.Reset()
+	serve(handler, "GET", "/users/3", "")
+	metric.WriteTo(cw)
+
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: get, Name: "http_server_requests", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: post, Name: "http_server_requests", Unit: "Count", Values: []float64{0}})
+	if d, found := cw.Find("my-app", post, "http_server_latency"); found {
+		t.Errorf("idle series must not record latency: %+v", d)
+	}
+
+	// idle series are forgotten after recording zero once
+	cw.Reset()
+	metric.WriteTo(cw)
+
+	if _, found := cw.Find("my-app", post, "http_server_requests"); found {
+		t.Errorf("forgotten series must not be recorded")
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerNoSwap$' ./emf/emfhttp
+func TestHandlerNoSwap(t *testing.T) {
+	metric := emf.New(emf.Options{}) // values are not swapped on render
+	cw := emftest.New()
+
+	handler := NewHandler(metric, http.NotFoundHandler(), HandlerOptions{RequestDimensions: []string{}})
+	dims := map[string]string{}
+
+	for range 3 {
+		serve(handler, "GET", "/", "")
+	}
+	metric.Datums() // like a scrape between flushes
+	for range 2 {
+		serve(handler, "GET", "/", "")
+	}
+
+	metric.WriteTo(cw)
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: dims, Name: "http_server_requests", Unit: "Count", Values: []float64{5}})
+
+	// idle flushes must not send the previous counts or latencies again
+	for range 2 {
+		cw.Reset()
+		metric.WriteTo(cw)
+		cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: dims, Name: "http_server_requests", Unit: "Count", Values: []float64{0}})
+		if d, found := cw.Find(emf.DefaultNamespace, dims, "http_server_latency"); found {
+			t.Errorf("stale latency sent again: %+v", d)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerCardinality$' ./emf/emfhttp
+func TestHandlerCardinality(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+
+	handler := NewHandler(metric, http.NotFoundHandler(), HandlerOptions{
+		RequestDimensions: []string{DimensionRoute, DimensionMethod},
+		Route:             func(r *http.Request) string { return r.URL.Path },
+		MaxRoutes:         2,
+	})
+
+	serve(handler, "GET", "/a", "")
+	serve(handler, "GET", "/b", "")
+	serve(handler, "GET", "/c", "")
+	serve(handler, "BREW", "/a", "")
+
+	metric.WriteTo(cw)
+
+	for _, e := range []struct {
+		route, method string
+	}{
+		{"/a", "GET"}, {"/b", "GET"}, {"other", "GET"}, {"/a", "OTHER"},
+	} {
+		cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: map[string]string{"route": e.route, "method": e.method},
+			Name: "http_server_requests", Unit: "Count", Values: []float64{1}})
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerOptionalInterfaces$' ./emf/emfhttp
+func TestHandlerOptionalInterfaces(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+
+	var flush, hijack, readFrom bool
+	handler := NewHandler(metric, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, flush = w.(http.Flusher)
+		_, hijack = w.(http.Hijacker)
+		rf, isReaderFrom := w.(io.ReaderFrom)
+		readFrom = isReaderFrom
+		if isReaderFrom {
+			rf.ReadFrom(strings.NewReader("streamed"))
+		}
+	}), HandlerOptions{RequestDimensions: []string{}})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !flush || !hijack || !readFrom {
+		t.Errorf("server writer interfaces lost: flusher=%t hijacker=%t readerFrom=%t", flush, hijack, readFrom)
+	}
+
+	metric.WriteTo(cw)
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: map[string]string{}, Name: "http_server_response_bytes", Unit: "Bytes", Values: []float64{8}})
+
+	// recorder implements only http.Flusher
+	serve(handler, "GET", "/", "")
+	if !flush || hijack || readFrom {
+		t.Errorf("recorder interfaces: flusher=%t hijacker=%t readerFrom=%t", flush, hijack, readFrom)
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerDefaultNamespace$' ./emf/emfhttp
+func TestHandlerDefaultNamespace(t *testing.T) {
+	metric := emf.New(emf.Options{})
+	handler := NewHandler(metric, http.NotFoundHandler(), HandlerOptions{})
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	for _, line := range metric.Render() {
+		if err := emf.Validate([]byte(line)); err != nil {
+			t.Errorf("invalid document: %v: %s", err, line)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package emfhttp
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+// Client dimensions recorded by default.
+const (
+	DimensionHost = "host" // request host, like "api.example.com"
+)
+
+// Client metrics.
+var (
+	metricClientRequests = emf.MetricDefinition{Name: "http_client_requests", Unit: "Count"}
+	metricClientLatency  = emf.MetricDefinition{Name: "http_client_latency", Unit: "Milliseconds"}
+	metricClientErrors   = emf.MetricDefinition{Name: "http_client_errors", Unit: "Count"}
+	metricClientRetries  = emf.MetricDefinition{Name: "http_client_retries", Unit: "Count"}
+)
+
+// TransportOptions define client transport options.
+type TransportOptions struct {
+	// Namespace is the EMF namespace.
+	// Empty Namespace defaults to emf.DefaultNamespace.
+	Namespace string
+
+	// Dimensions are added to every metric, like service name.
+	Dimensions map[string]string
+
+	// RequestDimensions returns the dimensions of a request, like target
+	// host and operation. Nil defaults to DimensionHost and
+	// DimensionMethod. DimensionStatusClass is always added, with value
+	// "error" for requests failed without response.
+	RequestDimensions func(r *http.Request) map[string]string
+
+	// MaxHosts limits distinct hosts recorded by the default
+	// RequestDimensions. Further hosts are recorded as "other".
+	// Zero defaults to 100.
+	MaxHosts int
+}
+
+// transport records client metrics around next.
+type transport struct {
+	next       http.RoundTripper
+	options    TransportOptions
+	aggregator *aggregator
+	hosts      *guard
+}
+
+// NewTransport wraps next to record, per request dimensions and status
+// class: request count, latency, errors and retries. Nil next uses
+// http.DefaultTransport. Metrics are recorded on every flush of m.
+func NewTransport(m *emf.Metric, next http.RoundTripper, options TransportOptions) http.RoundTripper {
+	options.Namespace = cmp.Or(options.Namespace, emf.DefaultNamespace)
+	t := &transport{
+		next:       cmp.Or(next, http.DefaultTransport),
+		options:    options,
+		aggregator: newAggregator(),
+		hosts:      newGuard(cmp.Or(options.MaxHosts, 100), "other"),
+	}
+	if t.options.RequestDimensions == nil {
+		t.options.RequestDimensions = t.defaultDimensions
+	}
+	m.AddCollector(t)
+	return t
+}
+
+func (t *transport) defaultDimensions(r *http.Request) map[string]string {
+	return map[string]string{
+		DimensionHost:   t.hosts.value(cmp.Or(r.Host, r.URL.Host)),
+		DimensionMethod: methodValue(r.Method),
+	}
+}
+
+// retryKey marks retried requests in their context.
+type retryKey struct{}
+
+// WithRetry marks requests using the returned context as retries of a
+// previous attempt, for them to be counted as retries. Retry loops
+// should use it for every attempt but the first.
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func isRetry(ctx context.Context) bool {
+	retry, _ := ctx.Value(retryKey{}).(bool)
+	return retry
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	begin := time.Now()
+
+	resp, err := t.next.RoundTrip(r)
+
+	elapsed := time.Since(begin)
+
+	dims := maps.Clone(t.options.Dimensions)
+	if dims == nil {
+		dims = map[string]string{}
+	}
+	maps.Copy(dims, t.options.RequestDimensions(r))
+	if err != nil {
+		dims[DimensionStatusClass] = "error"
+	} else {
+		dims[DimensionStatusClass] = statusClass(resp.StatusCode)
+	}
+
+	t.aggregator.observe(dims, observation{
+		latency: float64(elapsed) / float64(time.Millisecond),
+		err:     err != nil,
+		retry:   isRetry(r.Context()),
+	})
+
+	return resp, err
+}
+
+// Collect records the requests sent since the previous flush.
+// Collect implements emf.Collector.
+func (t *transport) Collect(m *emf.Metric) {
+	ns := t.options.Namespace
+	for _, s := range t.aggregator.flush() {
+		m.Record(ns, metricClientRequests, s.dimensions, s.requests)
+		recordValues(m, ns, metricClientLatency, s.dimensions, s.latency)
+		m.Record(ns, metricClientErrors, s.dimensions, s.errors)
+		m.Record(ns, metricClientRetries, s.dimensions, s.retries)
+	}
+}
@@ -0,0 +1,158 @@
+package emfhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/emftest"
+)
+
+// go test -v -count 1 -run '^TestTransport$' ./emf/emfhttp
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+	client := &http.Client{Transport: NewTransport(metric, nil, TransportOptions{Namespace: "my-app"})}
+
+	get := func(ctx context.Context, target string) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	ctx := context.Background()
+	get(ctx, server.URL+"/ok")
+	get(ctx, server.URL+"/fail")
+	get(WithRetry(ctx), server.URL+"/fail")
+	get(ctx, "http://127.0.0.1:1/refused")
+
+	metric.WriteTo(cw)
+
+	ok := map[string]string{"host": host, "method": "GET", "status_class": "2xx"}
+	fail := map[string]string{"host": host, "method": "GET", "status_class": "5xx"}
+	refused := map[string]string{"host": "127.0.0.1:1", "method": "GET", "status_class": "error"}
+
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: ok, Name: "http_client_requests", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: fail, Name: "http_client_requests", Unit: "Count", Values: []float64{2}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: fail, Name: "http_client_retries", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: fail, Name: "http_client_errors", Unit: "Count", Values: []float64{0}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Dimensions: refused, Name: "http_client_errors", Unit: "Count", Values: []float64{1}})
+
+	if latency, _ := cw.Find("my-app", fail, "http_client_latency"); len(latency.Values) != 2 {
+		t.Errorf("expected 2 latencies, got %+v", latency)
+	}
+}
+
+// go test -v -count 1 -run '^TestTransportDimensions$' ./emf/emfhttp
+func TestTransportDimensions(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+	})
+	transport := NewTransport(metric, next, TransportOptions{
+		Dimensions: map[string]string{"service": "users"},
+		RequestDimensions: func(r *http.Request) map[string]string {
+			return map[string]string{"dependency": "billing", "operation": r.URL.Path}
+		},
+	})
+
+	transport.RoundTrip(&http.Request{Method: "GET", URL: &url.URL{Path: "/invoices"}})
+
+	metric.WriteTo(cw)
+
+	cw.Require(t, emftest.Expect{
+		Namespace:  emf.DefaultNamespace,
+		Dimensions: map[string]string{"service": "users", "dependency": "billing", "operation": "/invoices", "status_class": "4xx"},
+		Name:       "http_client_requests", Unit: "Count", Values: []float64{1},
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// go test -v -count 1 -run '^TestTransportNoSwap$' ./emf/emfhttp
+func TestTransportNoSwap(t *testing.T) {
+	metric := emf.New(emf.Options{}) // values are not swapped on render
+	cw := emftest.New()
+
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := NewTransport(metric, next, TransportOptions{})
+	dims := map[string]string{"host": "api", "method": "GET", "status_class": "2xx"}
+
+	transport.RoundTrip(&http.Request{Method: "GET", Host: "api", URL: &url.URL{}})
+	metric.WriteTo(cw)
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: dims, Name: "http_client_requests", Unit: "Count", Values: []float64{1}})
+
+	// idle flush must not send the previous count or latency again
+	cw.Reset()
+	metric.WriteTo(cw)
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: dims, Name: "http_client_requests", Unit: "Count", Values: []float64{0}})
+	if d, found := cw.Find(emf.DefaultNamespace, dims, "http_client_latency"); found {
+		t.Errorf("stale latency sent again: %+v", d)
+	}
+}
+
+// go test -v -count 1 -run '^TestTransportDimensionsAmbiguity$' ./emf/emfhttp
+func TestTransportDimensionsAmbiguity(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	cw := emftest.New()
+
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := NewTransport(metric, next, TransportOptions{
+		RequestDimensions: func(r *http.Request) map[string]string {
+			if r.URL.Path == "/joined" {
+				return map[string]string{"a": "b\x00c=d"}
+			}
+			return map[string]string{"a": "b", "c": "d"}
+		},
+	})
+
+	transport.RoundTrip(&http.Request{Method: "GET", URL: &url.URL{Path: "/joined"}})
+	transport.RoundTrip(&http.Request{Method: "GET", URL: &url.URL{Path: "/split"}})
+
+	metric.WriteTo(cw)
+
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: map[string]string{"a": "b\x00c=d", "status_class": "2xx"},
+		Name: "http_client_requests", Unit: "Count", Values: []float64{1}})
+	cw.Require(t, emftest.Expect{Namespace: emf.DefaultNamespace, Dimensions: map[string]string{"a": "b", "c": "d", "status_class": "2xx"},
+		Name: "http_client_requests", Unit: "Count", Values: []float64{1}})
+}
+
+// go test -v -count 1 -run '^TestTransportDefaultNamespace$' ./emf/emfhttp
+func TestTransportDefaultNamespace(t *testing.T) {
+	metric := emf.New(emf.Options{})
+
+	next := roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	transport := NewTransport(metric, next, TransportOptions{})
+
+	transport.RoundTrip(&http.Request{Method: "GET", Host: "api", URL: &url.URL{}})
+
+	for _, line := range metric.Render() {
+		if err := emf.Validate([]byte(line)); err != nil {
+			t.Errorf("invalid document: %v: %s", err, line)
+		}
+	}
+}
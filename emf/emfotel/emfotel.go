@@ -0,0 +1,487 @@
+// Package emfotel provides an OpenTelemetry sdk/metric exporter that
+// writes EMF.
+//
+// Exporter records OTel sums, gauges and histograms into an emf.Metric
+// and hands the metric to a Sink on every export, like a writer or
+// CloudWatch Logs:
+//
+//	exporter := emfotel.New(emfotel.Options{Sink: emfotel.WriterSink(os.Stdout)})
+//	provider := metric.NewMeterProvider(metric.WithReader(metric.NewPeriodicReader(exporter)))
+//
+// Metrics are mapped as follows:
+//
+//   - Gauges and non-monotonic sums record their current value.
+//   - Monotonic sums record the increase over the export interval.
+//     Cumulative sums are converted to increases by the exporter.
+//   - Histograms record the observations over the export interval as an
+//     EMF value array built from bucket counts, plus name_count and
+//     name_sum increases.
+//
+// Data point attributes become dimensions. Resource attributes may be
+// mapped to dimensions added to every metric, or to EMF properties.
+package emfotel
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/internal/delta"
+)
+
+// Sink delivers the EMF documents of an export. Sink must not retain m.
+type Sink func(ctx context.Context, m *emf.Metric) error
+
+// WriterSink writes EMF documents to w.
+func WriterSink(w io.Writer) Sink {
+	return func(_ context.Context, m *emf.Metric) error {
+		_, err := m.WriteTo(w)
+		return err
+	}
+}
+
+// LogsClient is implemented by the cloudwatchlogs client.
+type LogsClient interface {
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput,
+		optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// CloudWatchSink sends EMF documents to a CloudWatch Logs stream,
+// batched within PutLogEvents limits.
+func CloudWatchSink(client LogsClient, group, stream string) Sink {
+	return func(ctx context.Context, m *emf.Metric) error {
+		for _, batch := range emf.BatchLogEvents(m.CloudWatchLogEvents()) {
+			_, err := client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+				LogGroupName:  aws.String(group),
+				LogStreamName: aws.String(stream),
+				LogEvents:     batch,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Options define exporter options.
+type Options struct {
+	// Namespace is the EMF namespace. Empty Namespace defaults to the
+	// resource attribute service.name, then to "OpenTelemetry".
+	Namespace string
+
+	// ResourceDimensions lists resource attributes added as dimensions
+	// to every metric, like service.name.
+	ResourceDimensions []string
+
+	// ResourceProperties lists resource attributes added as EMF
+	// properties to every document, like service.version.
+	ResourceProperties []string
+
+	// Temporality selects the temporality per instrument kind.
+	// Nil defaults to metric.DeltaTemporalitySelector.
+	Temporality metric.TemporalitySelector
+
+	// Aggregation selects the aggregation per instrument kind.
+	// Nil defaults to metric.DefaultAggregationSelector.
+	Aggregation metric.AggregationSelector
+
+	// Sink receives the metrics of every export.
+	// Nil defaults to WriterSink(os.Stdout).
+	Sink Sink
+
+	// UnixMilli is passed to emf.Options.
+	UnixMilli func() int64
+}
+
+const defaultNamespace = "OpenTelemetry"
+
+// Exporter is an OpenTelemetry sdk/metric exporter that writes EMF.
+type Exporter struct {
+	options     Options
+	metric      *emf.Metric // created on first export, from resource
+	resource    attribute.Distinct
+	deltas      *delta.Tracker[seriesKey]       // cumulative series => last value
+	exponential map[seriesKey]*exponentialState // cumulative exponential histogram => last buckets
+	epoch       uint64                          // export count, to forget vanished series
+	shutdown    bool
+	lock        sync.Mutex
+}
+
+// seriesKey identifies a cumulative series, or part of it like a bucket.
+type seriesKey struct {
+	name       string
+	attributes attribute.Distinct
+	part       string
+}
+
+var _ metric.Exporter = (*Exporter)(nil)
+
+// New creates an exporter.
+func New(options Options) *Exporter {
+	if options.Temporality == nil {
+		options.Temporality = metric.DeltaTemporalitySelector
+	}
+	if options.Aggregation == nil {
+		options.Aggregation = metric.DefaultAggregationSelector
+	}
+	if options.Sink == nil {
+		options.Sink = WriterSink(os.Stdout)
+	}
+	return &Exporter{
+		options:     options,
+		deltas:      delta.New[seriesKey](),
+		exponential: map[seriesKey]*exponentialState{},
+	}
+}
+
+// Temporality implements metric.Exporter.
+func (e *Exporter) Temporality(k metric.InstrumentKind) metricdata.Temporality {
+	return e.options.Temporality(k)
+}
+
+// Aggregation implements metric.Exporter.
+func (e *Exporter) Aggregation(k metric.InstrumentKind) metric.Aggregation {
+	return e.options.Aggregation(k)
+}
+
+// Export records rm into EMF and hands it to the sink.
+// Export implements metric.Exporter.
+func (e *Exporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.shutdown {
+		return metric.ErrExporterShutdown
+	}
+
+	m := e.getMetric(rm.Resource)
+	ns := cmp.Or(e.options.Namespace, resourceValue(rm.Resource, "service.name"), defaultNamespace)
+	resourceDims := map[string]string{}
+	for _, k := range e.options.ResourceDimensions {
+		if v, found := rm.Resource.Set().Value(attribute.Key(k)); found {
+			resourceDims[k] = v.Emit()
+		}
+	}
+
+	for _, sm := range rm.ScopeMetrics {
+		for _, data := range sm.Metrics {
+			e.record(m, ns, resourceDims, data)
+		}
+	}
+	e.sweep()
+
+	return e.options.Sink(ctx, m)
+}
+
+// getMetric returns the metric table, recreated whenever the resource
+// changes, as properties come from the resource.
+// Caller must hold e.lock.
+func (e *Exporter) getMetric(res *resource.Resource) *emf.Metric {
+	if e.metric != nil && e.resource == res.Equivalent() {
+		return e.metric
+	}
+	properties := map[string]string{}
+	for _, k := range e.options.ResourceProperties {
+		if v, found := res.Set().Value(attribute.Key(k)); found {
+			properties[k] = v.Emit()
+		}
+	}
+	e.metric = emf.New(emf.Options{
+		UnixMilli:    e.options.UnixMilli,
+		SwapOnRender: true, // every export renders only its own data
+		Properties:   properties,
+	})
+	e.resource = res.Equivalent()
+	return e.metric
+}
+
+func resourceValue(res *resource.Resource, key string) string {
+	if v, found := res.Set().Value(attribute.Key(key)); found {
+		return v.Emit()
+	}
+	return ""
+}
+
+// record records one OTel metric.
+// Caller must hold e.lock.
+func (e *Exporter) record(m *emf.Metric, ns string, resourceDims map[string]string, data metricdata.Metrics) {
+	md := emf.MetricDefinition{Name: data.Name, Unit: Unit(data.Unit)}
+
+	switch agg := data.Data.(type) {
+	case metricdata.Gauge[int64]:
+		recordGauge(m, ns, md, resourceDims, agg)
+	case metricdata.Gauge[float64]:
+		recordGauge(m, ns, md, resourceDims, agg)
+	case metricdata.Sum[int64]:
+		recordSum(e, m, ns, md, resourceDims, agg)
+	case metricdata.Sum[float64]:
+		recordSum(e, m, ns, md, resourceDims, agg)
+	case metricdata.Histogram[int64]:
+		recordExplicit(e, m, ns, md, resourceDims, agg)
+	case metricdata.Histogram[float64]:
+		recordExplicit(e, m, ns, md, resourceDims, agg)
+	case metricdata.ExponentialHistogram[int64]:
+		recordExponential(e, m, ns, md, resourceDims, agg)
+	case metricdata.ExponentialHistogram[float64]:
+		recordExponential(e, m, ns, md, resourceDims, agg)
+	}
+}
+
+// recordGauge records gauge data points.
+func recordGauge[N int64 | float64](m *emf.Metric, ns string, md emf.MetricDefinition,
+	resourceDims map[string]string, agg metricdata.Gauge[N]) {
+	for _, dp := range agg.DataPoints {
+		m.RecordFloat(ns, md, dimensions(resourceDims, dp.Attributes), float64(dp.Value))
+	}
+}
+
+// recordSum records sum data points.
+// Caller must hold e.lock.
+func recordSum[N int64 | float64](e *Exporter, m *emf.Metric, ns string, md emf.MetricDefinition,
+	resourceDims map[string]string, agg metricdata.Sum[N]) {
+	for _, dp := range agg.DataPoints {
+		v := e.sumValue(md.Name, agg.Temporality, agg.IsMonotonic, dp.Attributes, float64(dp.Value))
+		m.RecordFloat(ns, md, dimensions(resourceDims, dp.Attributes), v)
+	}
+}
+
+// recordExplicit records explicit bucket histogram data points.
+// Caller must hold e.lock.
+func recordExplicit[N int64 | float64](e *Exporter, m *emf.Metric, ns string, md emf.MetricDefinition,
+	resourceDims map[string]string, agg metricdata.Histogram[N]) {
+	for _, dp := range agg.DataPoints {
+		e.recordHistogram(m, ns, md, resourceDims, agg.Temporality, histogramPoint{
+			attributes: dp.Attributes,
+			count:      dp.Count,
+			sum:        float64(dp.Sum),
+			boundaries: explicitBoundaries(dp.Bounds),
+			counts:     dp.BucketCounts,
+		})
+	}
+}
+
+// recordExponential records exponential histogram data points.
+// Caller must hold e.lock.
+func recordExponential[N int64 | float64](e *Exporter, m *emf.Metric, ns string, md emf.MetricDefinition,
+	resourceDims map[string]string, agg metricdata.ExponentialHistogram[N]) {
+	for _, dp := range agg.DataPoints {
+		e.recordHistogram(m, ns, md, resourceDims, agg.Temporality,
+			e.exponentialPoint(md.Name, agg.Temporality, dp.Attributes, dp.Count, float64(dp.Sum),
+				dp.Scale, dp.ZeroCount, dp.PositiveBucket, dp.NegativeBucket))
+	}
+}
+
+// sumValue returns the value recorded for a sum data point: the
+// increase for monotonic sums and the current value otherwise.
+// Caller must hold e.lock.
+func (e *Exporter) sumValue(name string, temporality metricdata.Temporality, monotonic bool,
+	attributes attribute.Set, value float64) float64 {
+	if !monotonic || temporality == metricdata.DeltaTemporality {
+		return value
+	}
+	return e.deltas.Delta(seriesKey{name: name, attributes: attributes.Equivalent()}, value)
+}
+
+type histogramPoint struct {
+	attributes attribute.Set
+	count      uint64
+	sum        float64
+	boundaries []float64
+	counts     []uint64
+	increases  bool // counts are increases even if cumulative
+}
+
+// exponentialPoint converts an exponential histogram data point. For
+// cumulative temporality, its buckets are converted to increases here,
+// as bucket boundaries change whenever the SDK rescales.
+// Caller must hold e.lock.
+func (e *Exporter) exponentialPoint(name string, temporality metricdata.Temporality, attributes attribute.Set,
+	count uint64, sum float64, scale int32, zeroCount uint64, positive, negative metricdata.ExponentialBucket) histogramPoint {
+
+	cumulative := temporality == metricdata.CumulativeTemporality
+	if cumulative {
+		key := seriesKey{name: name, attributes: attributes.Equivalent()}
+		zeroCount, positive, negative = e.exponentialIncrease(key, scale, zeroCount, positive, negative)
+	}
+	boundaries, counts := exponentialBuckets(scale, zeroCount, positive, negative)
+	return histogramPoint{
+		attributes: attributes,
+		count:      count,
+		sum:        sum,
+		boundaries: boundaries,
+		counts:     counts,
+		increases:  cumulative,
+	}
+}
+
+// recordHistogram records histogram values, count and sum.
+// Caller must hold e.lock.
+func (e *Exporter) recordHistogram(m *emf.Metric, ns string, md emf.MetricDefinition,
+	resourceDims map[string]string, temporality metricdata.Temporality, p histogramPoint) {
+
+	count := float64(p.count)
+	sum := p.sum
+	counts := p.counts
+
+	if temporality == metricdata.CumulativeTemporality {
+		key := seriesKey{name: md.Name, attributes: p.attributes.Equivalent()}
+		if !p.increases {
+			counts = make([]uint64, len(p.counts))
+			for i, c := range p.counts {
+				// explicit buckets are keyed by lower boundary, stable
+				// across exports
+				key.part = strconv.FormatFloat(p.boundaries[i], 'g', -1, 64)
+				counts[i] = uint64(e.deltas.Delta(key, float64(c)))
+			}
+		}
+		key.part = "count"
+		count = e.deltas.Delta(key, count)
+		key.part = "sum"
+		sum = e.deltas.Delta(key, sum)
+	}
+
+	dims := dimensions(resourceDims, p.attributes)
+	m.RecordValues(ns, md, dims, emf.HistogramValues(p.boundaries, counts))
+	m.RecordFloat(ns, emf.MetricDefinition{Name: md.Name + "_count", Unit: "Count"}, dims, count)
+	m.RecordFloat(ns, emf.MetricDefinition{Name: md.Name + "_sum", Unit: md.Unit}, dims, sum)
+}
+
+// explicitBoundaries adds the implicit infinite boundaries to the upper
+// bounds of explicit histogram buckets.
+func explicitBoundaries(bounds []float64) []float64 {
+	boundaries := make([]float64, 0, len(bounds)+2)
+	boundaries = append(boundaries, math.Inf(-1))
+	boundaries = append(boundaries, bounds...)
+	return append(boundaries, math.Inf(1))
+}
+
+// exponentialBuckets converts exponential histogram buckets into
+// contiguous boundaries and counts, from the most negative bucket up.
+// Empty buckets fill the gaps around the zero bucket, which spans
+// zero width at 0.
+func exponentialBuckets(scale int32, zeroCount uint64, positive, negative metricdata.ExponentialBucket) ([]float64, []uint64) {
+	base := math.Exp2(math.Exp2(-float64(scale)))
+	bound := func(index int32) float64 {
+		return math.Pow(base, float64(index))
+	}
+
+	var boundaries []float64
+	var counts []uint64
+
+	// negative bucket i spans -base^(i+1) to -base^i
+	for i := len(negative.Counts) - 1; i >= 0; i-- {
+		index := negative.Offset + int32(i)
+		if len(boundaries) == 0 {
+			boundaries = append(boundaries, -bound(index+1))
+		}
+		boundaries = append(boundaries, -bound(index))
+		counts = append(counts, negative.Counts[i])
+	}
+	if len(boundaries) == 0 {
+		boundaries = append(boundaries, 0)
+	} else {
+		boundaries = append(boundaries, 0)
+		counts = append(counts, 0)
+	}
+
+	boundaries = append(boundaries, 0)
+	counts = append(counts, zeroCount)
+
+	// positive bucket i spans base^i to base^(i+1)
+	for i, c := range positive.Counts {
+		index := positive.Offset + int32(i)
+		if i == 0 {
+			boundaries = append(boundaries, bound(index))
+			counts = append(counts, 0)
+		}
+		boundaries = append(boundaries, bound(index+1))
+		counts = append(counts, c)
+	}
+
+	return boundaries, counts
+}
+
+// dimensions merges resource dimensions with data point attributes.
+func dimensions(resourceDims map[string]string, attributes attribute.Set) map[string]string {
+	dims := make(map[string]string, len(resourceDims)+attributes.Len())
+	for k, v := range resourceDims {
+		dims[k] = v
+	}
+	for iter := attributes.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		dims[string(kv.Key)] = kv.Value.Emit()
+	}
+	return dims
+}
+
+// ForceFlush implements metric.Exporter. Export is synchronous, so
+// there is nothing to flush.
+func (e *Exporter) ForceFlush(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Shutdown implements metric.Exporter.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	e.shutdown = true
+	e.lock.Unlock()
+	return ctx.Err()
+}
+
+// units maps UCUM units used by OpenTelemetry to EMF units.
+var units = map[string]string{
+	"s":      "Seconds",
+	"ms":     "Milliseconds",
+	"us":     "Microseconds",
+	"By":     "Bytes",
+	"kBy":    "Kilobytes",
+	"MBy":    "Megabytes",
+	"GBy":    "Gigabytes",
+	"TBy":    "Terabytes",
+	"bit":    "Bits",
+	"kbit":   "Kilobits",
+	"Mbit":   "Megabits",
+	"Gbit":   "Gigabits",
+	"Tbit":   "Terabits",
+	"%":      "Percent",
+	"1":      "None",
+	"By/s":   "Bytes/Second",
+	"kBy/s":  "Kilobytes/Second",
+	"MBy/s":  "Megabytes/Second",
+	"GBy/s":  "Gigabytes/Second",
+	"TBy/s":  "Terabytes/Second",
+	"bit/s":  "Bits/Second",
+	"kbit/s": "Kilobits/Second",
+	"Mbit/s": "Megabits/Second",
+	"Gbit/s": "Gigabits/Second",
+	"Tbit/s": "Terabits/Second",
+	"1/s":    "Count/Second",
+}
+
+// Unit maps an OpenTelemetry UCUM unit to an EMF unit. Annotations like
+// {request} map to Count, unknown units to None and empty unit to empty.
+func Unit(unit string) string {
+	if u, found := units[unit]; found {
+		return u
+	}
+	if len(unit) > 1 && unit[0] == '{' && unit[len(unit)-1] == '}' {
+		return "Count"
+	}
+	if unit == "" {
+		return ""
+	}
+	return "None"
+}
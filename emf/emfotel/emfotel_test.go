@@ -0,0 +1,230 @@
+package emfotel
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/emftest"
+)
+
+func newTestProvider(t *testing.T, options Options) (*metric.MeterProvider, *emftest.CloudWatch) {
+	t.Helper()
+	cw := emftest.New()
+	options.Sink = WriterSink(cw)
+	options.UnixMilli = func() int64 { return 0 }
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "my-svc"),
+		attribute.String("service.version", "1.2.3"),
+		attribute.String("deployment.environment", "prod"),
+	)
+	provider := metric.NewMeterProvider(
+		metric.WithResource(res),
+		metric.WithReader(metric.NewPeriodicReader(New(options))),
+	)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return provider, cw
+}
+
+func testTemporality(t *testing.T, temporality metric.TemporalitySelector) {
+	provider, cw := newTestProvider(t, Options{
+		Temporality:        temporality,
+		ResourceDimensions: []string{"deployment.environment"},
+		ResourceProperties: []string{"service.version"},
+	})
+	ctx := context.Background()
+
+	meter := provider.Meter("test")
+	requests, _ := meter.Int64Counter("requests", otelmetric.WithUnit("{request}"))
+	latency, _ := meter.Float64Histogram("latency", otelmetric.WithUnit("ms"),
+		otelmetric.WithExplicitBucketBoundaries(10, 100))
+	queue, _ := meter.Int64UpDownCounter("queue")
+
+	route := otelmetric.WithAttributes(attribute.String("route", "/users"))
+	dims := map[string]string{"deployment.environment": "prod", "route": "/users"}
+
+	requests.Add(ctx, 5, route)
+	latency.Record(ctx, 5, route) // first bucket represented by its upper bound
+	latency.Record(ctx, 50, route)
+	queue.Add(ctx, 3)
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "requests", Unit: "Count", Values: []float64{5}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "latency", Unit: "Milliseconds", Values: []float64{10, 55}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "latency_count", Unit: "Count", Values: []float64{2}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: map[string]string{"deployment.environment": "prod"},
+		Name: "queue", Values: []float64{3}})
+
+	// second export holds only the increases
+	requests.Add(ctx, 2, route)
+	latency.Record(ctx, 500, route)
+	queue.Add(ctx, 1)
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "requests", Unit: "Count", Values: []float64{2}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "latency", Unit: "Milliseconds", Values: []float64{100}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: dims, Name: "latency_sum", Unit: "Milliseconds", Values: []float64{500}})
+	cw.Require(t, emftest.Expect{Namespace: "my-svc", Dimensions: map[string]string{"deployment.environment": "prod"},
+		Name: "queue", Values: []float64{4}})
+}
+
+// go test -v -count 1 -run '^TestExporterDelta$' ./emf/emfotel
+func TestExporterDelta(t *testing.T) {
+	testTemporality(t, metric.DeltaTemporalitySelector)
+}
+
+// go test -v -count 1 -run '^TestExporterCumulative$' ./emf/emfotel
+func TestExporterCumulative(t *testing.T) {
+	testTemporality(t, metric.CumulativeTemporalitySelector)
+}
+
+// go test -v -count 1 -run '^TestExporterProperties$' ./emf/emfotel
+func TestExporterProperties(t *testing.T) {
+	var lines []string
+	exporter := New(Options{
+		ResourceProperties: []string{"service.version"},
+		Sink: func(_ context.Context, m *emf.Metric) error {
+			lines = m.Render()
+			return nil
+		},
+	})
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(attribute.String("service.version", "1.2.3")),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Metrics: []metricdata.Metrics{{
+				Name: "temperature",
+				Data: metricdata.Gauge[float64]{DataPoints: []metricdata.DataPoint[float64]{{Value: 21.5}}},
+			}},
+		}},
+	}
+
+	if err := exporter.Export(context.Background(), rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("expected one document, got %v", lines)
+	}
+
+	doc, err := emf.Parse([]byte(lines[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Properties["service.version"] != "1.2.3" {
+		t.Errorf("missing property: %v", doc.Properties)
+	}
+	if d := doc.Datums[0]; d.Namespace != defaultNamespace || d.Values[0] != 21.5 {
+		t.Errorf("unexpected datum: %+v", d)
+	}
+
+	exporter.Shutdown(context.Background())
+	if err := exporter.Export(context.Background(), rm); err != metric.ErrExporterShutdown {
+		t.Errorf("expected shutdown error, got %v", err)
+	}
+}
+
+// go test -v -count 1 -run '^TestExporterExponentialRescale$' ./emf/emfotel
+func TestExporterExponentialRescale(t *testing.T) {
+	cw := emftest.New()
+	exporter := New(Options{Namespace: "my-app", Sink: WriterSink(cw)})
+	ctx := context.Background()
+
+	export := func(points ...metricdata.ExponentialHistogramDataPoint[float64]) {
+		t.Helper()
+		rm := &metricdata.ResourceMetrics{
+			Resource: resource.Empty(),
+			ScopeMetrics: []metricdata.ScopeMetrics{{
+				Metrics: []metricdata.Metrics{{
+					Name: "latency",
+					Data: metricdata.ExponentialHistogram[float64]{
+						Temporality: metricdata.CumulativeTemporality,
+						DataPoints:  points,
+					},
+				}},
+			}},
+		}
+		if err := exporter.Export(ctx, rm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 50 observations in buckets [1,√2) and [√2,2)
+	export(metricdata.ExponentialHistogramDataPoint[float64]{
+		Count: 50, Sum: 60, Scale: 1,
+		PositiveBucket: metricdata.ExponentialBucket{Offset: 0, Counts: []uint64{30, 20}},
+	})
+
+	// one more observation, after the SDK rescaled into bucket [1,2)
+	cw.Reset()
+	export(metricdata.ExponentialHistogramDataPoint[float64]{
+		Count: 51, Sum: 61.5, Scale: 0,
+		PositiveBucket: metricdata.ExponentialBucket{Offset: 0, Counts: []uint64{51}},
+	})
+
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Name: "latency", Values: []float64{1.5}})
+	cw.Require(t, emftest.Expect{Namespace: "my-app", Name: "latency_count", Unit: "Count", Values: []float64{1}})
+
+	// vanished series are forgotten
+	export()
+	if n := len(exporter.exponential); n != 0 {
+		t.Errorf("expected exponential state pruned, got %d series", n)
+	}
+	if n := exporter.deltas.Len(); n != 0 {
+		t.Errorf("expected cumulative state pruned, got %d series", n)
+	}
+}
+
+// go test -v -count 1 -run '^TestExponentialBuckets$' ./emf/emfotel
+func TestExponentialBuckets(t *testing.T) {
+	// scale 0: base 2, bucket i spans 2^i to 2^(i+1)
+	boundaries, counts := exponentialBuckets(0, 1,
+		metricdata.ExponentialBucket{Offset: 1, Counts: []uint64{2, 3}},
+		metricdata.ExponentialBucket{Offset: 0, Counts: []uint64{4}},
+	)
+
+	expectBoundaries := []float64{-2, -1, 0, 0, 2, 4, 8}
+	expectCounts := []uint64{4, 0, 1, 0, 2, 3}
+	if !slices.Equal(boundaries, expectBoundaries) || !slices.Equal(counts, expectCounts) {
+		t.Fatalf("boundaries: expected=%v got=%v counts: expected=%v got=%v",
+			expectBoundaries, boundaries, expectCounts, counts)
+	}
+
+	values := emf.HistogramValues(boundaries, counts)
+	expectValues := []float64{-1.5, -1.5, -1.5, -1.5, 0, 3, 3, 6, 6, 6}
+	if !slices.Equal(values, expectValues) {
+		t.Errorf("values: expected=%v got=%v", expectValues, values)
+	}
+
+	if _, counts := exponentialBuckets(0, 0, metricdata.ExponentialBucket{}, metricdata.ExponentialBucket{}); slices.ContainsFunc(counts, func(c uint64) bool { return c > 0 }) {
+		t.Errorf("empty histogram must have no counts: %v", counts)
+	}
+}
+
+// go test -v -count 1 -run '^TestUnit$' ./emf/emfotel
+func TestUnit(t *testing.T) {
+	table := map[string]string{
+		"s":         "Seconds",
+		"By/s":      "Bytes/Second",
+		"{request}": "Count",
+		"":          "",
+		"furlong":   "None",
+	}
+	for unit, expect := range table {
+		if got := Unit(unit); got != expect {
+			t.Errorf("Unit(%q): expected=%s got=%s", unit, expect, got)
+		}
+	}
+}
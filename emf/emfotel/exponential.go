@@ -0,0 +1,130 @@
+package emfotel
+
+import (
+	"slices"
+
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// exponentialState is the last cumulative exponential histogram of a
+// series, kept to compute bucket increases across exports.
+type exponentialState struct {
+	scale    int32
+	zero     uint64
+	positive map[int32]uint64 // bucket index => count
+	negative map[int32]uint64
+	epoch    uint64 // export of the last update
+}
+
+func newExponentialState(scale int32, zero uint64, positive, negative metricdata.ExponentialBucket) *exponentialState {
+	return &exponentialState{
+		scale:    scale,
+		zero:     zero,
+		positive: indexBuckets(positive),
+		negative: indexBuckets(negative),
+	}
+}
+
+func indexBuckets(b metricdata.ExponentialBucket) map[int32]uint64 {
+	counts := make(map[int32]uint64, len(b.Counts))
+	for i, c := range b.Counts {
+		if c > 0 {
+			counts[b.Offset+int32(i)] = c
+		}
+	}
+	return counts
+}
+
+// downscale merges buckets into a scale lower by shift, where bucket i
+// falls into bucket i>>shift.
+func downscale(counts map[int32]uint64, shift int32) map[int32]uint64 {
+	if shift == 0 {
+		return counts
+	}
+	merged := make(map[int32]uint64, len(counts))
+	for i, c := range counts {
+		merged[i>>shift] += c
+	}
+	return merged
+}
+
+// increase returns the bucket increases of s since previous, whose scale
+// must not be lower than the scale of s. Since the SDK only ever lowers
+// the scale, previous buckets are downscaled to the scale of s, so past
+// observations are not counted again. increase reports false if some
+// bucket decreased, as after a reset.
+func (s *exponentialState) increase(previous *exponentialState) (zero uint64,
+	positive, negative metricdata.ExponentialBucket, ok bool) {
+
+	if s.zero < previous.zero {
+		return 0, positive, negative, false
+	}
+	shift := previous.scale - s.scale
+	if positive, ok = subtractBuckets(s.positive, downscale(previous.positive, shift)); !ok {
+		return 0, positive, negative, false
+	}
+	if negative, ok = subtractBuckets(s.negative, downscale(previous.negative, shift)); !ok {
+		return 0, positive, negative, false
+	}
+	return s.zero - previous.zero, positive, negative, true
+}
+
+// subtractBuckets returns the contiguous bucket counts of current minus
+// previous, reporting false if some bucket decreased.
+func subtractBuckets(current, previous map[int32]uint64) (metricdata.ExponentialBucket, bool) {
+	for i, c := range previous {
+		if current[i] < c {
+			return metricdata.ExponentialBucket{}, false
+		}
+	}
+	var b metricdata.ExponentialBucket
+	indices := make([]int32, 0, len(current))
+	for i, c := range current {
+		if c > previous[i] {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) == 0 {
+		return b, true
+	}
+	slices.Sort(indices)
+	b.Offset = indices[0]
+	b.Counts = make([]uint64, indices[len(indices)-1]-b.Offset+1)
+	for _, i := range indices {
+		b.Counts[i-b.Offset] = current[i] - previous[i]
+	}
+	return b, true
+}
+
+// exponentialIncrease returns the bucket increases of a cumulative
+// exponential histogram since the previous export. The first export
+// of a series, a reset, or a scale increase, which the SDK never does,
+// return the buckets in full.
+// Caller must hold e.lock.
+func (e *Exporter) exponentialIncrease(key seriesKey, scale int32, zero uint64,
+	positive, negative metricdata.ExponentialBucket) (uint64, metricdata.ExponentialBucket, metricdata.ExponentialBucket) {
+
+	current := newExponentialState(scale, zero, positive, negative)
+	current.epoch = e.epoch
+	previous, found := e.exponential[key]
+	e.exponential[key] = current
+
+	if found && previous.scale >= scale {
+		if z, p, n, ok := current.increase(previous); ok {
+			return z, p, n
+		}
+	}
+	return zero, positive, negative
+}
+
+// sweep forgets cumulative series missing from the latest export.
+// Caller must hold e.lock.
+func (e *Exporter) sweep() {
+	e.deltas.Sweep()
+	for k, s := range e.exponential {
+		if s.epoch != e.epoch {
+			delete(e.exponential, k)
+		}
+	}
+	e.epoch++
+}
@@ -0,0 +1,405 @@
+// Package emfprom exposes EMF metrics in the Prometheus text exposition
+// format, so the same instrumentation can be scraped outside AWS.
+//
+// Namespace and metric name are joined into the Prometheus metric name,
+// dimensions become labels and the EMF unit becomes a name suffix:
+//
+//	Record("my-app", MetricDefinition{Name: "latency", Unit: "Milliseconds"}, {"route": "/"}, 12)
+//
+// is exposed as
+//
+//	# HELP my_app_latency_milliseconds EMF metric latency in namespace my-app.
+//	# TYPE my_app_latency_milliseconds gauge
+//	my_app_latency_milliseconds{route="/"} 12
+//
+// Metrics holding single values are exposed as gauges. Metrics holding
+// value arrays, like histograms recorded with RecordValues, are exposed
+// as summaries of the values: quantiles 0.5, 0.9 and 0.99, plus
+// name_sum and name_count. Metrics named like the sum and count of a
+// summary, like the name_count and name_sum recorded along histograms
+// by packages emfgather and emfotel, are exposed as those.
+//
+// Dimension names are sanitized into label names. Names reserved by
+// Prometheus, starting with "__", lose extra leading underscores, and
+// names colliding after sanitization, like "a-b" and "a_b", get suffixes
+// _2, _3 and so on.
+package emfprom
+
+import (
+	"bufio"
+	"cmp"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler serves the current metric table in Prometheus text format,
+// as a /metrics endpoint. Contexts older than emf.Options.TTL are left
+// out, but evicted only by rendering.
+//
+// Handler does not run collectors, like those of packages emfruntime,
+// emfhttp and emfgather, which rendering EMF runs. A workload that only
+// serves /metrics should run them on every scrape:
+//
+//	http.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		metric.Collect()
+//		emfprom.Handler(metric).ServeHTTP(w, r)
+//	}))
+func Handler(m *emf.Metric) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		WriteMetric(w, m)
+	})
+}
+
+// WriteMetric writes the current metric table in Prometheus text format.
+// It neither takes values from a metric in SwapOnRender mode nor calls
+// its collectors.
+func WriteMetric(w io.Writer, m *emf.Metric) error {
+	return WriteDatums(w, m.Datums())
+}
+
+// WriteDatums writes datums in Prometheus text format.
+// When several datums map to the same series, as when converting
+// parsed EMF logs, the last one wins.
+func WriteDatums(w io.Writer, datums []emf.Datum) error {
+	families := map[string]*family{}
+
+	for _, d := range datums {
+		if len(d.Values) == 0 {
+			continue
+		}
+		name := MetricName(d.Namespace, d.Metric.Name, d.Metric.Unit)
+		f, found := families[name]
+		if !found {
+			f = &family{
+				name:   name,
+				help:   "EMF metric " + d.Metric.Name + " in namespace " + d.Namespace + ".",
+				series: map[string]series{},
+			}
+			families[name] = f
+		}
+		f.series[formatLabels(dimensionLabels(d.Dimensions))] = series{
+			dimensions: d.Dimensions,
+			values:     d.Values,
+		}
+		f.summary = f.summary || d.Array
+	}
+
+	mergeSummaryChildren(families)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range slices.Sorted(maps.Keys(families)) {
+		families[name].write(bw)
+	}
+	return bw.Flush()
+}
+
+// summarySuffixes name the sample count and sum of summaries.
+var summarySuffixes = []string{"_sum", "_count"}
+
+// mergeSummaryChildren merges gauge families named like the sum or
+// count of a summary family into it, like name_count recorded along
+// with histograms, since Prometheus parsers take them for the summary
+// sum and count. Their values take the place of those computed from
+// the summary values.
+func mergeSummaryChildren(families map[string]*family) {
+	for _, f := range families {
+		if !f.summary {
+			continue
+		}
+		for _, suffix := range summarySuffixes {
+			child, found := families[f.name+suffix]
+			if !found || child.summary {
+				continue
+			}
+			if f.children == nil {
+				f.children = map[string]*family{}
+			}
+			f.children[suffix] = child
+			delete(families, child.name)
+		}
+	}
+}
+
+type family struct {
+	name     string
+	help     string
+	series   map[string]series  // formatted labels => series
+	summary  bool               // some series holds a value array
+	children map[string]*family // summary suffix => merged family
+}
+
+type series struct {
+	dimensions map[string]string
+	values     []float64
+}
+
+func (s series) last() float64 {
+	return s.values[len(s.values)-1]
+}
+
+// quantiles exposed for summaries.
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+func (f *family) write(w *bufio.Writer) {
+	metricType := "gauge"
+	if f.summary {
+		metricType = "summary"
+	}
+	w.WriteString("# HELP ")
+	w.WriteString(f.name)
+	w.WriteByte(' ')
+	w.WriteString(escapeHelp(f.help))
+	w.WriteString("\n# TYPE ")
+	w.WriteString(f.name)
+	w.WriteByte(' ')
+	w.WriteString(metricType)
+	w.WriteByte('\n')
+	if !f.summary {
+		for _, labels := range slices.Sorted(maps.Keys(f.series)) {
+			writeSample(w, f.name, labels, f.series[labels].last())
+		}
+		return
+	}
+	for _, labels := range f.summaryLabels() {
+		f.writeSummary(w, labels)
+	}
+}
+
+// summaryLabels returns the sorted labels of the series of a summary and
+// of its merged children.
+func (f *family) summaryLabels() []string {
+	labels := slices.Collect(maps.Keys(f.series))
+	for _, child := range f.children {
+		for l := range child.series {
+			if _, found := f.series[l]; !found {
+				labels = append(labels, l)
+			}
+		}
+	}
+	slices.Sort(labels)
+	return slices.Compact(labels)
+}
+
+// child returns the series of the merged family named with suffix.
+func (f *family) child(suffix, labels string) (series, bool) {
+	child, found := f.children[suffix]
+	if !found {
+		return series{}, false
+	}
+	s, found := child.series[labels]
+	return s, found
+}
+
+// writeSummary writes quantiles, sum and count of the series values.
+// Merged sum and count take precedence over those of the values.
+func (f *family) writeSummary(w *bufio.Writer, key string) {
+	s, hasValues := f.series[key]
+	sum, hasSum := f.child("_sum", key)
+	count, hasCount := f.child("_count", key)
+
+	dimensions := s.dimensions
+	switch {
+	case hasValues:
+	case hasSum:
+		dimensions = sum.dimensions
+	default:
+		dimensions = count.dimensions
+	}
+	labels := dimensionLabels(dimensions, "quantile")
+
+	if hasValues {
+		values := slices.Sorted(slices.Values(s.values))
+		for _, q := range quantiles {
+			ql := append(slices.Clone(labels), label{"quantile", formatValue(q)})
+			writeSample(w, f.name, formatLabels(ql), quantile(values, q))
+		}
+		if !hasSum {
+			sum = series{values: []float64{total(values)}}
+		}
+		if !hasCount {
+			count = series{values: []float64{float64(len(values))}}
+		}
+	}
+	if hasValues || hasSum {
+		writeSample(w, f.name+"_sum", formatLabels(labels), sum.last())
+	}
+	if hasValues || hasCount {
+		writeSample(w, f.name+"_count", formatLabels(labels), count.last())
+	}
+}
+
+func total(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	w.WriteString(labels)
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+// quantile returns the q-quantile of sorted values, by nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// MetricName builds the Prometheus metric name for an EMF metric,
+// joining namespace, metric name and unit suffix, like
+// "my_app_latency_milliseconds". Units None and Count add no suffix.
+// A suffix already ending the metric name is not repeated.
+func MetricName(namespace, name, unit string) string {
+	s := name
+	if namespace != "" {
+		s = namespace + "_" + name
+	}
+	s = sanitize(s, true)
+	if suffix := unitSuffix(unit); suffix != "" && !strings.HasSuffix(s, "_"+suffix) {
+		s += "_" + suffix
+	}
+	return s
+}
+
+// unitSuffix maps EMF unit to metric name suffix, like "Bytes/Second"
+// to "bytes_per_second".
+func unitSuffix(unit string) string {
+	switch unit {
+	case "", "None", "Count":
+		return ""
+	case "Count/Second":
+		return "per_second"
+	}
+	return strings.ToLower(strings.ReplaceAll(unit, "/", "_per_"))
+}
+
+type label struct{ name, value string }
+
+// dimensionLabels maps dimensions to labels. Dimensions already named as
+// valid labels keep their names. Names colliding with reserved names or
+// with a previous label get suffixes _2, _3 and so on, in dimension name
+// order.
+func dimensionLabels(dimensions map[string]string, reserved ...string) []label {
+	keys := slices.Collect(maps.Keys(dimensions))
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(compareBool(labelName(a) != a, labelName(b) != b), strings.Compare(a, b))
+	})
+	taken := make(map[string]bool, len(dimensions)+len(reserved))
+	for _, r := range reserved {
+		taken[r] = true
+	}
+	labels := make([]label, 0, len(dimensions))
+	for _, k := range keys {
+		base := labelName(k)
+		name := base
+		for i := 2; taken[name]; i++ {
+			name = base + "_" + strconv.Itoa(i)
+		}
+		taken[name] = true
+		labels = append(labels, label{name, dimensions[k]})
+	}
+	return labels
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// labelName sanitizes a dimension name into a label name. Names starting
+// with "__", reserved by Prometheus, keep a single leading underscore.
+func labelName(dimension string) string {
+	name := sanitize(dimension, false)
+	if strings.HasPrefix(name, "__") {
+		name = "_" + strings.TrimLeft(name, "_")
+	}
+	return name
+}
+
+// formatLabels formats labels sorted by name, like `{a="1",b="2"}`.
+// No labels yield an empty string.
+func formatLabels(labels []label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	labels = slices.SortedFunc(slices.Values(labels), func(a, b label) int {
+		return strings.Compare(a.name, b.name)
+	})
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(l.name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(l.value))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// sanitize replaces characters not allowed in Prometheus metric names
+// (colon included) or label names (colon excluded) with underscores.
+// A leading digit is prefixed with an underscore.
+func sanitize(s string, colon bool) string {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	b := []byte(s)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9') || (colon && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,190 @@
+package emfprom
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/emfgather"
+)
+
+// go test -v -count 1 -run '^TestHandler$' ./emf/emfprom
+func TestHandler(t *testing.T) {
+	metric := emf.New(emf.Options{})
+
+	latency := emf.MetricDefinition{Name: "latency", Unit: "Milliseconds"}
+	requests := emf.MetricDefinition{Name: "requests", Unit: "Count"}
+	throughput := emf.MetricDefinition{Name: "throughput", Unit: "Bytes/Second"}
+
+	metric.Record("my-app", latency, map[string]string{"route": "/", "method": "GET"}, 12)
+	metric.Record("my-app", latency, map[string]string{"route": `/a"b`, "method": "GET"}, 7)
+	metric.Record("my-app", requests, nil, 3)
+	metric.Record("my-app", throughput, map[string]string{"host.name": "a"}, 100)
+
+	server := httptest.NewServer(Handler(metric))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if ct := resp.Header.Get("Content-Type"); ct != ContentType {
+		t.Errorf("content type: %s", ct)
+	}
+
+	const expect = `# HELP my_app_latency_milliseconds EMF metric latency in namespace my-app.
+# TYPE my_app_latency_milliseconds gauge
+my_app_latency_milliseconds{method="GET",route="/"} 12
+my_app_latency_milliseconds{method="GET",route="/a\"b"} 7
+# HELP my_app_requests EMF metric requests in namespace my-app.
+# TYPE my_app_requests gauge
+my_app_requests 3
+# HELP my_app_throughput_bytes_per_second EMF metric throughput in namespace my-app.
+# TYPE my_app_throughput_bytes_per_second gauge
+my_app_throughput_bytes_per_second{host_name="a"} 100
+`
+	if got := string(body); got != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+}
+
+// go test -v -count 1 -run '^TestWriteDatumsLastWins$' ./emf/emfprom
+func TestWriteDatumsLastWins(t *testing.T) {
+	md := emf.MetricDefinition{Name: "m"}
+	datums := []emf.Datum{
+		{Namespace: "ns", Metric: md, Values: []float64{1}},
+		{Namespace: "ns", Metric: md, Values: []float64{2}},
+	}
+
+	var sb strings.Builder
+	if err := WriteDatums(&sb, datums); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(sb.String(), "\nns_m 2\n") {
+		t.Errorf("unexpected output:\n%s", sb.String())
+	}
+}
+
+// go test -v -count 1 -run '^TestWriteDatumsSummary$' ./emf/emfprom
+func TestWriteDatumsSummary(t *testing.T) {
+	md := emf.MetricDefinition{Name: "latency", Unit: "Milliseconds"}
+	datums := []emf.Datum{
+		{Namespace: "ns", Metric: md, Dimensions: map[string]string{"quantile": "x"},
+			Values: []float64{5, 1, 4, 2, 3, 6, 7, 8, 9, 10}, Array: true},
+		{Namespace: "ns", Metric: md, Values: []float64{7}},
+	}
+
+	var sb strings.Builder
+	if err := WriteDatums(&sb, datums); err != nil {
+		t.Fatal(err)
+	}
+
+	const expect = `# HELP ns_latency_milliseconds EMF metric latency in namespace ns.
+# TYPE ns_latency_milliseconds summary
+ns_latency_milliseconds{quantile="0.5"} 7
+ns_latency_milliseconds{quantile="0.9"} 7
+ns_latency_milliseconds{quantile="0.99"} 7
+ns_latency_milliseconds_sum 7
+ns_latency_milliseconds_count 1
+ns_latency_milliseconds{quantile="0.5",quantile_2="x"} 5
+ns_latency_milliseconds{quantile="0.9",quantile_2="x"} 9
+ns_latency_milliseconds{quantile="0.99",quantile_2="x"} 10
+ns_latency_milliseconds_sum{quantile_2="x"} 55
+ns_latency_milliseconds_count{quantile_2="x"} 10
+`
+	if got := sb.String(); got != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+}
+
+// go test -v -count 1 -run '^TestWriteDatumsLabelCollisions$' ./emf/emfprom
+func TestWriteDatumsLabelCollisions(t *testing.T) {
+	datums := []emf.Datum{{
+		Namespace:  "ns",
+		Metric:     emf.MetricDefinition{Name: "m"},
+		Dimensions: map[string]string{"a-b": "1", "a_b": "2", "a.b": "3", "__name__": "4"},
+		Values:     []float64{1},
+	}}
+
+	var sb strings.Builder
+	if err := WriteDatums(&sb, datums); err != nil {
+		t.Fatal(err)
+	}
+
+	const expect = `ns_m{_name__="4",a_b="2",a_b_2="1",a_b_3="3"} 1`
+	if !strings.Contains(sb.String(), expect+"\n") {
+		t.Errorf("expected %s, got:\n%s", expect, sb.String())
+	}
+}
+
+// go test -v -count 1 -run '^TestMetricName$' ./emf/emfprom
+func TestMetricName(t *testing.T) {
+	table := []struct {
+		namespace, name, unit string
+		expect                string
+	}{
+		{"ns", "m", "", "ns_m"},
+		{"ns", "m", "None", "ns_m"},
+		{"ns", "m", "Count/Second", "ns_m_per_second"},
+		{"ns", "duration_seconds", "Seconds", "ns_duration_seconds"},
+		{"", "m", "Percent", "m_percent"},
+		{"AWS/My App", "1st", "Kilobits", "AWS_My_App_1st_kilobits"},
+		{"", "1st", "", "_1st"},
+	}
+	for _, data := range table {
+		if got := MetricName(data.namespace, data.name, data.unit); got != data.expect {
+			t.Errorf("MetricName(%q,%q,%q): expected=%s got=%s",
+				data.namespace, data.name, data.unit, data.expect, got)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestWriteMetricParse$' ./emf/emfprom
+func TestWriteMetricParse(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	depth := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "queue_depth", Buckets: []float64{1, 10}})
+	registry.MustRegister(depth)
+
+	metric := emf.New(emf.Options{})
+	bridge := emfgather.New(registry, emfgather.Options{Namespace: "app"})
+
+	for _, observations := range [][]float64{{3}, {3, 20}} {
+		for _, v := range observations {
+			depth.Observe(v)
+		}
+		if err := bridge.Gather(metric); err != nil {
+			t.Fatal(err)
+		}
+
+		var sb strings.Builder
+		if err := WriteMetric(&sb, metric); err != nil {
+			t.Fatal(err)
+		}
+
+		parser := expfmt.NewTextParser(model.LegacyValidation)
+		families, err := parser.TextToMetricFamilies(strings.NewReader(sb.String()))
+		if err != nil {
+			t.Fatalf("parse: %v:\n%s", err, sb.String())
+		}
+		if len(families) != 1 {
+			t.Errorf("expected a single family, got %d:\n%s", len(families), sb.String())
+		}
+		f := families["app_queue_depth"]
+		if f.GetType() != dto.MetricType_SUMMARY {
+			t.Fatalf("expected summary, got %v:\n%s", f.GetType(), sb.String())
+		}
+		summary := f.GetMetric()[0].GetSummary()
+		if count := summary.GetSampleCount(); count != uint64(len(observations)) {
+			t.Errorf("expected count %d from app_queue_depth_count, got %d", len(observations), count)
+		}
+	}
+}
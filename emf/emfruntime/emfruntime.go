@@ -0,0 +1,208 @@
+// Package emfruntime records Go runtime metrics into EMF.
+//
+// Collector samples runtime/metrics on every flush of an emf.Metric:
+//
+//	metric.AddCollector(emfruntime.New(emfruntime.Options{Namespace: "my-app"}))
+//
+// Cumulative runtime metrics, like GC cycles, record the increase since
+// the previous sample. The first sample records the full value.
+// Histograms, like GC pauses, record the observations since the previous
+// sample as an EMF value array, and are left out of flushes without
+// observations.
+package emfruntime
+
+import (
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/internal/delta"
+)
+
+// RuntimeMetric maps a runtime/metrics sample to an EMF metric.
+type RuntimeMetric struct {
+	// Runtime is the runtime/metrics name, like "/sched/goroutines:goroutines".
+	Runtime string
+
+	// Name is the EMF metric name. Empty Name is derived from Runtime,
+	// like "sched_goroutines_goroutines".
+	Name string
+
+	// Unit is the EMF unit. Empty Unit is inferred from the runtime unit,
+	// like Bytes for ":bytes" and Seconds for ":seconds".
+	Unit string
+}
+
+// DefaultMetrics is the curated set of runtime metrics recorded when
+// Options.Metrics is nil.
+var DefaultMetrics = []RuntimeMetric{
+	{Runtime: "/sched/goroutines:goroutines", Name: "goroutines", Unit: "Count"},
+	{Runtime: "/sched/gomaxprocs:threads", Name: "gomaxprocs", Unit: "Count"},
+	{Runtime: "/memory/classes/total:bytes", Name: "memory_total_bytes", Unit: "Bytes"},
+	{Runtime: "/memory/classes/heap/objects:bytes", Name: "heap_objects_bytes", Unit: "Bytes"},
+	{Runtime: "/gc/heap/objects:objects", Name: "heap_objects", Unit: "Count"},
+	{Runtime: "/gc/heap/allocs:bytes", Name: "heap_allocs_bytes", Unit: "Bytes"},
+	{Runtime: "/gc/heap/goal:bytes", Name: "gc_heap_goal_bytes", Unit: "Bytes"},
+	{Runtime: "/gc/cycles/total:gc-cycles", Name: "gc_cycles", Unit: "Count"},
+	{Runtime: "/cpu/classes/gc/total:cpu-seconds", Name: "gc_cpu_seconds", Unit: "Seconds"},
+	{Runtime: "/sched/pauses/total/gc:seconds", Name: "gc_pauses_seconds", Unit: "Seconds"},
+	{Runtime: "/sched/latencies:seconds", Name: "sched_latencies_seconds", Unit: "Seconds"},
+}
+
+// Options define collector options.
+type Options struct {
+	// Namespace is the EMF namespace.
+	// Empty Namespace defaults to emf.DefaultNamespace.
+	Namespace string
+
+	// Dimensions are added to every metric, like service name.
+	Dimensions map[string]string
+
+	// Metrics lists the runtime metrics recorded. Nil uses DefaultMetrics.
+	// Metrics unsupported by the running Go version are skipped.
+	Metrics []RuntimeMetric
+}
+
+// Collector records Go runtime metrics into an emf.Metric.
+// Collector implements emf.Collector, and is safe for concurrent use.
+type Collector struct {
+	options     Options
+	definitions []emf.MetricDefinition
+	cumulative  []bool
+	samples     []metrics.Sample
+	deltas      *delta.Tracker[bucketKey]
+	lock        sync.Mutex
+}
+
+// bucketKey identifies a cumulative sample, or a bucket of a histogram
+// sample.
+type bucketKey struct {
+	sample int
+	bucket int // -1 for non-histogram samples
+}
+
+// New creates a Collector.
+func New(options Options) *Collector {
+	if options.Namespace == "" {
+		options.Namespace = emf.DefaultNamespace
+	}
+	if options.Metrics == nil {
+		options.Metrics = DefaultMetrics
+	}
+
+	supported := map[string]metrics.Description{}
+	for _, d := range metrics.All() {
+		supported[d.Name] = d
+	}
+
+	c := &Collector{options: options, deltas: delta.New[bucketKey]()}
+	for _, rm := range options.Metrics {
+		d, found := supported[rm.Runtime]
+		if !found {
+			continue
+		}
+		c.definitions = append(c.definitions, emf.MetricDefinition{
+			Name: metricName(rm),
+			Unit: metricUnit(rm),
+		})
+		c.cumulative = append(c.cumulative, d.Cumulative)
+		c.samples = append(c.samples, metrics.Sample{Name: rm.Runtime})
+	}
+	return c
+}
+
+// Collect samples the runtime and records into m.
+// Collect implements emf.Collector.
+func (c *Collector) Collect(m *emf.Metric) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	metrics.Read(c.samples)
+
+	ns := c.options.Namespace
+	dims := c.options.Dimensions
+
+	for i, s := range c.samples {
+		md := c.definitions[i]
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			m.RecordFloat(ns, md, dims, c.delta(i, float64(s.Value.Uint64())))
+		case metrics.KindFloat64:
+			m.RecordFloat(ns, md, dims, c.delta(i, s.Value.Float64()))
+		case metrics.KindFloat64Histogram:
+			values := c.histogramValues(i, s.Value.Float64Histogram())
+			if len(values) == 0 {
+				// no observations: drop the previous array, which a metric
+				// not in SwapOnRender mode would render again
+				m.RemoveMetric(ns, md.Name, dims)
+				continue
+			}
+			m.RecordValues(ns, md, dims, values)
+		}
+	}
+}
+
+// delta returns the increase of cumulative sample i since the previous
+// collect, or value if sample i is not cumulative.
+// Caller must hold c.lock.
+func (c *Collector) delta(i int, value float64) float64 {
+	if !c.cumulative[i] {
+		return value
+	}
+	return c.deltas.Delta(bucketKey{sample: i, bucket: -1}, value)
+}
+
+// histogramValues expands the bucket increases of histogram sample i
+// since the previous collect into EMF values.
+// Caller must hold c.lock.
+func (c *Collector) histogramValues(i int, h *metrics.Float64Histogram) []float64 {
+	counts := make([]uint64, len(h.Counts))
+	for j, count := range h.Counts {
+		if c.cumulative[i] {
+			counts[j] = uint64(c.deltas.Delta(bucketKey{sample: i, bucket: j}, float64(count)))
+		} else {
+			counts[j] = count
+		}
+	}
+	return emf.HistogramValues(h.Buckets, counts)
+}
+
+// metricName returns the EMF name of rm.
+func metricName(rm RuntimeMetric) string {
+	if rm.Name != "" {
+		return rm.Name
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', ':', '-', '*':
+			return '_'
+		}
+		return r
+	}, strings.TrimPrefix(rm.Runtime, "/"))
+}
+
+// runtimeUnits maps runtime/metrics units to EMF units.
+var runtimeUnits = map[string]string{
+	"bytes":       "Bytes",
+	"seconds":     "Seconds",
+	"cpu-seconds": "Seconds",
+	"percent":     "Percent",
+}
+
+// metricUnit returns the EMF unit of rm, inferring unknown runtime
+// units as Count, since runtime/metrics counts things like goroutines
+// and gc-cycles.
+func metricUnit(rm RuntimeMetric) string {
+	if rm.Unit != "" {
+		return rm.Unit
+	}
+	_, unit, _ := strings.Cut(rm.Runtime, ":")
+	if u, found := runtimeUnits[unit]; found {
+		return u
+	}
+	if strings.Contains(unit, "/") {
+		return "None" // rates, like bytes/second, have no exact EMF unit
+	}
+	return "Count"
+}
@@ -0,0 +1,110 @@
+package emfruntime
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/emftest"
+)
+
+func findDatum(datums []emf.Datum, name string) (emf.Datum, bool) {
+	for _, d := range datums {
+		if d.Metric.Name == name {
+			return d, true
+		}
+	}
+	return emf.Datum{}, false
+}
+
+// go test -v -count 1 -run '^TestCollector$' ./emf/emfruntime
+func TestCollector(t *testing.T) {
+	metric := emf.New(emf.Options{SwapOnRender: true})
+	metric.AddCollector(New(Options{
+		Namespace:  "my-app",
+		Dimensions: map[string]string{"service": "users"},
+	}))
+
+	metric.Render() // first sample holds values since process start
+
+	runtime.GC()
+	cw := emftest.New()
+	metric.WriteTo(cw)
+	datums := cw.Datums()
+
+	goroutines, found := findDatum(datums, "goroutines")
+	if !found || goroutines.Values[0] < 1 || goroutines.Metric.Unit != "Count" ||
+		goroutines.Namespace != "my-app" || goroutines.Dimensions["service"] != "users" {
+		t.Errorf("unexpected goroutines: %+v", goroutines)
+	}
+
+	if cycles, found := findDatum(datums, "gc_cycles"); !found || cycles.Values[0] < 1 {
+		t.Errorf("expected gc cycles since previous sample: %+v", cycles)
+	}
+
+	if pauses, found := findDatum(datums, "gc_pauses_seconds"); !found || len(pauses.Values) < 1 ||
+		pauses.Metric.Unit != "Seconds" {
+		t.Errorf("expected gc pauses since previous sample: %+v", pauses)
+	}
+}
+
+// go test -v -count 1 -run '^TestCollectorMetrics$' ./emf/emfruntime
+func TestCollectorMetrics(t *testing.T) {
+	metric := emf.New(emf.Options{})
+	metric.AddCollector(New(Options{
+		Metrics: []RuntimeMetric{
+			{Runtime: "/memory/classes/heap/free:bytes"},
+			{Runtime: "/no/such/metric:bytes"},
+		},
+	}))
+
+	cw := emftest.New()
+	metric.WriteTo(cw)
+	datums := cw.Datums()
+	if len(datums) != 1 {
+		t.Fatalf("expected only the supported metric, got %+v", datums)
+	}
+	if md := datums[0].Metric; md.Name != "memory_classes_heap_free_bytes" || md.Unit != "Bytes" {
+		t.Errorf("unexpected definition: %+v", md)
+	}
+}
+
+// go test -v -count 1 -run '^TestCollectorNoPauses$' ./emf/emfruntime
+func TestCollectorNoPauses(t *testing.T) {
+	defer debug.SetGCPercent(debug.SetGCPercent(-1)) // only explicit GC
+
+	metric := emf.New(emf.Options{}) // values are not swapped on render
+	metric.AddCollector(New(Options{
+		Metrics: []RuntimeMetric{{Runtime: "/sched/pauses/total/gc:seconds", Name: "gc_pauses_seconds"}},
+	}))
+
+	runtime.GC()
+	cw := emftest.New()
+	metric.WriteTo(cw)
+	if _, found := findDatum(cw.Datums(), "gc_pauses_seconds"); !found {
+		t.Fatalf("expected gc pauses")
+	}
+
+	cw.Reset()
+	metric.WriteTo(cw)
+	if d, found := findDatum(cw.Datums(), "gc_pauses_seconds"); found {
+		t.Errorf("previous pauses must not be sent again: %+v", d)
+	}
+}
+
+// go test -v -count 1 -run '^TestCollectorDefaultNamespace$' ./emf/emfruntime
+func TestCollectorDefaultNamespace(t *testing.T) {
+	metric := emf.New(emf.Options{})
+	metric.AddCollector(New(Options{}))
+
+	lines := metric.Render()
+	if len(lines) == 0 {
+		t.Fatal("expected documents")
+	}
+	for _, line := range lines {
+		if err := emf.Validate([]byte(line)); err != nil {
+			t.Errorf("invalid document: %v: %s", err, line)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Package emfsim simulates CloudWatch metric extraction for offline
+// debugging.
+//
+// Simulator ingests EMF documents and builds the metric time series
+// CloudWatch would create from them. Query aggregates a series into
+// datapoints per period, 1s for high resolution metrics and 60s for
+// standard resolution metrics, with the statistics Sum, Min, Max,
+// SampleCount, Average and percentiles.
+package emfsim
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/udhos/aws-emf/emf"
+	"github.com/udhos/aws-emf/emf/internal/serieskey"
+)
+
+// Query errors.
+var (
+	ErrSeriesNotFound = errors.New("series not found")
+	ErrInvalidPeriod  = errors.New("invalid period")
+)
+
+// Simulator builds metric time series from EMF documents.
+// A Simulator is safe for concurrent use.
+type Simulator struct {
+	series map[string]*series // series key => series
+	lock   sync.Mutex
+}
+
+type series struct {
+	info    Series
+	samples []sample
+}
+
+type sample struct {
+	timestamp int64 // unix milli
+	value     float64
+}
+
+// Series describes a metric time series.
+type Series struct {
+	Namespace  string
+	Name       string
+	Dimensions map[string]string
+
+	// Unit is the unit of the latest datum.
+	Unit string
+
+	// StorageResolution is 1 if any datum was high resolution, else 60.
+	StorageResolution int
+
+	// Samples counts values received.
+	Samples int
+}
+
+// New creates a Simulator.
+func New() *Simulator {
+	return &Simulator{series: map[string]*series{}}
+}
+
+// Ingest parses an EMF document and adds its datums to the series.
+func (s *Simulator) Ingest(line []byte) error {
+	doc, err := emf.Parse(line)
+	if err != nil {
+		return err
+	}
+	for _, d := range doc.Datums {
+		s.IngestDatum(d)
+	}
+	return nil
+}
+
+// IngestDatum adds a datum to its series.
+func (s *Simulator) IngestDatum(d emf.Datum) {
+	key := seriesKey(d.Namespace, d.Metric.Name, d.Dimensions)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ser, found := s.series[key]
+	if !found {
+		ser = &series{info: Series{
+			Namespace:         d.Namespace,
+			Name:              d.Metric.Name,
+			Dimensions:        maps.Clone(d.Dimensions),
+			StorageResolution: 60,
+		}}
+		s.series[key] = ser
+	}
+	ser.info.Unit = d.Metric.Unit
+	if d.Metric.StorageResolution == 1 {
+		ser.info.StorageResolution = 1
+	}
+	for _, v := range d.Values {
+		ser.samples = append(ser.samples, sample{timestamp: d.Timestamp, value: v})
+	}
+	ser.info.Samples = len(ser.samples)
+}
+
+// ReadFrom ingests newline-delimited EMF documents from r.
+// Blank lines are ignored. ReadFrom stops at the first invalid document,
+// reporting its line number.
+// ReadFrom implements io.ReaderFrom.
+func (s *Simulator) ReadFrom(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*emf.MaxDocumentSize)
+	var n int64
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		n += int64(len(scanner.Bytes())) + 1
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := s.Ingest(line); err != nil {
+			return n, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	return n, scanner.Err()
+}
+
+// Reset drops all series.
+func (s *Simulator) Reset() {
+	s.lock.Lock()
+	clear(s.series)
+	s.lock.Unlock()
+}
+
+// Series lists all series, sorted by namespace, metric name and dimensions.
+func (s *Simulator) Series() []Series {
+	s.lock.Lock()
+	list := make([]Series, 0, len(s.series))
+	for _, ser := range s.series {
+		info := ser.info
+		info.Dimensions = maps.Clone(info.Dimensions)
+		list = append(list, info)
+	}
+	s.lock.Unlock()
+	slices.SortFunc(list, compareSeries)
+	return list
+}
+
+// Query selects a series and the statistics to compute.
+type Query struct {
+	Namespace  string
+	Name       string
+	Dimensions map[string]string // must match series dimensions exactly
+
+	// Period defaults to 1s for high resolution series and 60s for
+	// standard resolution series. Period must be a multiple of 1s,
+	// and of 60s for standard resolution series.
+	Period time.Duration
+
+	// Start is inclusive and End is exclusive. Zero means unbounded.
+	Start time.Time
+	End   time.Time
+
+	// Percentiles lists percentiles to compute, like 50 or 99.9.
+	Percentiles []float64
+}
+
+// Datapoint holds statistics for one period of a series.
+type Datapoint struct {
+	Timestamp   time.Time // period start
+	SampleCount float64
+	Sum         float64
+	Min         float64
+	Max         float64
+	Average     float64
+	Percentiles map[float64]float64 // percentile => value
+	Unit        string
+}
+
+// Query aggregates a series into datapoints, one per period with
+// samples, in chronological order.
+func (s *Simulator) Query(q Query) ([]Datapoint, error) {
+	key := seriesKey(q.Namespace, q.Name, q.Dimensions)
+
+	s.lock.Lock()
+	ser, found := s.series[key]
+	if !found {
+		s.lock.Unlock()
+		return nil, fmt.Errorf("%w: namespace=%s metric=%s dimensions=%v",
+			ErrSeriesNotFound, q.Namespace, q.Name, q.Dimensions)
+	}
+	info := ser.info
+	samples := slices.Clone(ser.samples)
+	s.lock.Unlock()
+
+	period := q.Period
+	if period == 0 {
+		period = time.Duration(info.StorageResolution) * time.Second
+	}
+	if period <= 0 || period%time.Second != 0 ||
+		(info.StorageResolution != 1 && period%time.Minute != 0) {
+		return nil, fmt.Errorf("%w: %v for storage resolution %d",
+			ErrInvalidPeriod, period, info.StorageResolution)
+	}
+	periodMs := period.Milliseconds()
+
+	slices.SortStableFunc(samples, func(a, b sample) int {
+		return cmp.Compare(a.timestamp, b.timestamp)
+	})
+
+	var points []Datapoint
+	var bucket []float64
+	var bucketStart int64
+
+	flush := func() {
+		if len(bucket) > 0 {
+			points = append(points, aggregate(time.UnixMilli(bucketStart), bucket, q.Percentiles, info.Unit))
+			bucket = bucket[:0]
+		}
+	}
+
+	for _, smp := range samples {
+		if !q.Start.IsZero() && smp.timestamp < q.Start.UnixMilli() {
+			continue
+		}
+		if !q.End.IsZero() && smp.timestamp >= q.End.UnixMilli() {
+			continue
+		}
+		start := smp.timestamp - mod(smp.timestamp, periodMs)
+		if start != bucketStart {
+			flush()
+			bucketStart = start
+		}
+		bucket = append(bucket, smp.value)
+	}
+	flush()
+
+	return points, nil
+}
+
+func aggregate(t time.Time, values []float64, percentiles []float64, unit string) Datapoint {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	dp := Datapoint{
+		Timestamp:   t,
+		SampleCount: float64(len(sorted)),
+		Sum:         sum,
+		Min:         sorted[0],
+		Max:         sorted[len(sorted)-1],
+		Average:     sum / float64(len(sorted)),
+		Unit:        unit,
+	}
+
+	if len(percentiles) > 0 {
+		dp.Percentiles = make(map[float64]float64, len(percentiles))
+		for _, p := range percentiles {
+			dp.Percentiles[p] = percentile(sorted, p)
+		}
+	}
+
+	return dp
+}
+
+// percentile computes the nearest-rank percentile p of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
+
+// mod is the modulus with the sign of d, so that timestamps before
+// the epoch still fall at period starts.
+func mod(n, d int64) int64 {
+	m := n % d
+	if m < 0 {
+		m += d
+	}
+	return m
+}
+
+// seriesKey identifies a series by namespace, metric name and dimensions.
+func seriesKey(namespace, name string, dimensions map[string]string) string {
+	return serieskey.Key(dimensions, namespace, name)
+}
+
+// compareSeries orders series by namespace, metric name and dimensions.
+func compareSeries(a, b Series) int {
+	return cmp.Or(
+		strings.Compare(a.Namespace, b.Namespace),
+		strings.Compare(a.Name, b.Name),
+		compareDimensions(a.Dimensions, b.Dimensions),
+	)
+}
+
+// compareDimensions orders dimensions by their names and values, taken
+// in name order.
+func compareDimensions(a, b map[string]string) int {
+	ka := slices.Sorted(maps.Keys(a))
+	kb := slices.Sorted(maps.Keys(b))
+	for i := range min(len(ka), len(kb)) {
+		if c := cmp.Or(strings.Compare(ka[i], kb[i]), strings.Compare(a[ka[i]], b[kb[i]])); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(ka), len(kb))
+}
@@ -0,0 +1,183 @@
+package emfsim
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+func newTestSimulator(t *testing.T) *Simulator {
+	t.Helper()
+
+	var now int64
+	metric := emf.New(emf.Options{UnixMilli: func() int64 { return now }})
+	standard := emf.MetricDefinition{Name: "latency", Unit: "Milliseconds"}
+	high := emf.MetricDefinition{Name: "requests", Unit: "Count", StorageResolution: 1}
+	dim := map[string]string{"host": "a"}
+
+	sim := New()
+	var sb strings.Builder
+
+	// 1..10 in first minute, 100 in second minute
+	for i := 1; i <= 10; i++ {
+		now = int64(i) * 1000
+		metric.Record("ns", standard, dim, i)
+		metric.Record("ns", high, dim, i%2)
+		metric.Fprintln(&sb)
+	}
+	now = 61000
+	metric.Reset()
+	metric.Record("ns", standard, dim, 100)
+	metric.Fprintln(&sb)
+
+	if _, err := sim.ReadFrom(strings.NewReader(sb.String())); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	return sim
+}
+
+// go test -v -count 1 -run '^TestQueryStandardResolution$' ./emf/emfsim
+func TestQueryStandardResolution(t *testing.T) {
+	sim := newTestSimulator(t)
+
+	points, err := sim.Query(Query{
+		Namespace:   "ns",
+		Name:        "latency",
+		Dimensions:  map[string]string{"host": "a"},
+		Percentiles: []float64{50, 90, 100},
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 datapoints, got %d: %v", len(points), points)
+	}
+
+	checkFirstMinute(t, points[0])
+
+	p := points[1]
+	if !p.Timestamp.Equal(time.UnixMilli(60000)) || p.SampleCount != 1 || p.Sum != 100 {
+		t.Errorf("unexpected second datapoint: %+v", p)
+	}
+}
+
+// checkFirstMinute checks the datapoint of the first minute of the
+// latency samples from newTestSimulator.
+func checkFirstMinute(t *testing.T, p Datapoint) {
+	t.Helper()
+	if !p.Timestamp.Equal(time.UnixMilli(0)) {
+		t.Errorf("timestamp: %v", p.Timestamp)
+	}
+	if p.SampleCount != 10 || p.Sum != 55 || p.Min != 1 || p.Max != 10 || p.Average != 5.5 {
+		t.Errorf("unexpected statistics: %+v", p)
+	}
+	if p.Percentiles[50] != 5 || p.Percentiles[90] != 9 || p.Percentiles[100] != 10 {
+		t.Errorf("unexpected percentiles: %v", p.Percentiles)
+	}
+	if p.Unit != "Milliseconds" {
+		t.Errorf("unit: %s", p.Unit)
+	}
+}
+
+// go test -v -count 1 -run '^TestSeriesKey$' ./emf/emfsim
+func TestSeriesKey(t *testing.T) {
+	a := seriesKey("ns", "m", map[string]string{"a": "b\x00c"})
+	b := seriesKey("ns", "m", map[string]string{"a": "b", "c": ""})
+	if a == b {
+		t.Errorf("distinct series share key %q", a)
+	}
+}
+
+// go test -v -count 1 -run '^TestSeriesOrder$' ./emf/emfsim
+func TestSeriesOrder(t *testing.T) {
+	sim := New()
+	md := emf.MetricDefinition{Name: "m"}
+	sim.IngestDatum(emf.Datum{Namespace: "b", Metric: md, Values: []float64{1}})
+	sim.IngestDatum(emf.Datum{Namespace: "aa", Metric: md, Dimensions: map[string]string{"k": "2"}, Values: []float64{1}})
+	sim.IngestDatum(emf.Datum{Namespace: "aa", Metric: md, Dimensions: map[string]string{"k": "10"}, Values: []float64{1}})
+	sim.IngestDatum(emf.Datum{Namespace: "aa", Metric: md, Values: []float64{1}})
+
+	var got []string
+	for _, s := range sim.Series() {
+		got = append(got, s.Namespace+"/"+s.Dimensions["k"])
+	}
+	expect := []string{"aa/", "aa/10", "aa/2", "b/"}
+	if !slices.Equal(got, expect) {
+		t.Errorf("expected=%v got=%v", expect, got)
+	}
+}
+
+// go test -v -count 1 -run '^TestQueryHighResolution$' ./emf/emfsim
+func TestQueryHighResolution(t *testing.T) {
+	sim := newTestSimulator(t)
+
+	q := Query{
+		Namespace:  "ns",
+		Name:       "requests",
+		Dimensions: map[string]string{"host": "a"},
+	}
+
+	points, err := sim.Query(q)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(points) != 10 {
+		t.Fatalf("expected 10 datapoints at 1s period, got %d", len(points))
+	}
+
+	q.Period = 5 * time.Second
+	q.Start = time.UnixMilli(5000)
+	q.End = time.UnixMilli(10000)
+	points, err = sim.Query(q)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(points) != 1 || points[0].SampleCount != 5 || points[0].Sum != 3 {
+		t.Errorf("unexpected datapoints: %+v", points)
+	}
+}
+
+// go test -v -count 1 -run '^TestQueryErrors$' ./emf/emfsim
+func TestQueryErrors(t *testing.T) {
+	sim := newTestSimulator(t)
+
+	_, err := sim.Query(Query{Namespace: "ns", Name: "latency"})
+	if !errors.Is(err, ErrSeriesNotFound) {
+		t.Errorf("dimensions must match exactly: %v", err)
+	}
+
+	_, err = sim.Query(Query{
+		Namespace:  "ns",
+		Name:       "latency",
+		Dimensions: map[string]string{"host": "a"},
+		Period:     time.Second,
+	})
+	if !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("1s period for standard resolution: %v", err)
+	}
+}
+
+// go test -v -count 1 -run '^TestSeries$' ./emf/emfsim
+func TestSeries(t *testing.T) {
+	sim := newTestSimulator(t)
+
+	list := sim.Series()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(list))
+	}
+	if list[0].Name != "latency" || list[0].StorageResolution != 60 || list[0].Samples != 11 {
+		t.Errorf("unexpected series: %+v", list[0])
+	}
+	if list[1].Name != "requests" || list[1].StorageResolution != 1 || list[1].Samples != 10 {
+		t.Errorf("unexpected series: %+v", list[1])
+	}
+
+	sim.Reset()
+	if len(sim.Series()) != 0 {
+		t.Errorf("Reset must drop all series")
+	}
+}
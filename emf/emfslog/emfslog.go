@@ -0,0 +1,332 @@
+// Package emfslog provides a log/slog handler that emits EMF metrics
+// from structured log records.
+//
+// Handler writes ordinary records as JSON, like slog.JSONHandler.
+// A record carrying Metric attributes is written as an EMF document
+// instead: Dimension attributes form the dimension set, metric
+// attributes become metrics and every other attribute, including
+// the message and level, becomes a property.
+//
+//	logger := slog.New(emfslog.NewHandler(os.Stdout, &emfslog.Options{Namespace: "my-app"}))
+//	logger.Info("request served",
+//		emfslog.Dimension("route", "/users"),
+//		emfslog.Metric(emf.MetricDefinition{Name: "latency", Unit: "Milliseconds"}, 12.5),
+//		"request_id", id)
+package emfslog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+// metricValue is the value of a metric attribute.
+type metricValue struct {
+	definition emf.MetricDefinition
+	value      float64
+}
+
+// LogValue logs the metric as its value in ordinary records.
+func (m metricValue) LogValue() slog.Value {
+	return slog.Float64Value(m.value)
+}
+
+// dimensionValue is the value of a dimension attribute.
+type dimensionValue string
+
+// LogValue logs the dimension as its value in ordinary records.
+func (d dimensionValue) LogValue() slog.Value {
+	return slog.StringValue(string(d))
+}
+
+// Metric returns an attribute recording value for the metric md.
+// The attribute key is the metric name.
+func Metric(md emf.MetricDefinition, value float64) slog.Attr {
+	return slog.Any(md.Name, metricValue{definition: md, value: value})
+}
+
+// Dimension returns an attribute adding a dimension to the metrics of
+// the record. Without metrics, or with an empty value, which CloudWatch
+// rejects, it is logged as an ordinary string.
+func Dimension(key, value string) slog.Attr {
+	return slog.Any(key, dimensionValue(value))
+}
+
+// Options define handler options.
+type Options struct {
+	// Namespace is the EMF namespace of metrics.
+	// Empty Namespace defaults to emf.DefaultNamespace.
+	Namespace string
+
+	// Level is the minimum level logged. Nil defaults to slog.LevelInfo.
+	Level slog.Leveler
+}
+
+// Handler is a slog.Handler writing JSON log lines, and EMF documents
+// for records carrying metrics.
+type Handler struct {
+	options Options
+	json    slog.Handler
+	out     *lockedWriter
+	attrs   []groupedAttr // attributes added by WithAttrs
+	groups  []string      // groups opened by WithGroup
+}
+
+// groupedAttr is an attribute qualified by the groups open when it was
+// added.
+type groupedAttr struct {
+	groups []string
+	attr   slog.Attr
+}
+
+// lockedWriter serializes writes of the JSON and EMF paths.
+type lockedWriter struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	return lw.w.Write(p)
+}
+
+var _ slog.Handler = (*Handler)(nil)
+
+// NewHandler creates a handler writing to w. Nil options use defaults.
+func NewHandler(w io.Writer, options *Options) *Handler {
+	var opt Options
+	if options != nil {
+		opt = *options
+	}
+	if opt.Level == nil {
+		opt.Level = slog.LevelInfo
+	}
+	if opt.Namespace == "" {
+		opt.Namespace = emf.DefaultNamespace
+	}
+	out := &lockedWriter{w: w}
+	return &Handler{
+		options: opt,
+		json:    slog.NewJSONHandler(out, &slog.HandlerOptions{Level: opt.Level}),
+		out:     out,
+	}
+}
+
+// Enabled implements slog.Handler.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.options.Level.Level()
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	clone := *h
+	clone.json = h.json.WithAttrs(attrs)
+	clone.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, groupedAttr{groups: h.groups, attr: a})
+	}
+	return &clone
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.json = h.json.WithGroup(name)
+	clone.groups = append(slices.Clip(h.groups), name)
+	return &clone
+}
+
+// Handle writes r as an EMF document if it carries metrics, otherwise
+// as a JSON log line. Handle implements slog.Handler.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := slices.Clone(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, groupedAttr{groups: h.groups, attr: a})
+		return true
+	})
+
+	doc := newDocument()
+	for _, a := range attrs {
+		doc.add(a.groups, a.attr)
+	}
+
+	doc.shadowMetrics()
+	if len(doc.metrics) == 0 {
+		return h.json.Handle(ctx, r)
+	}
+
+	line, err := doc.render(h.options.Namespace, r)
+	if err != nil {
+		return err
+	}
+	_, err = h.out.Write(line)
+	return err
+}
+
+// document collects the members of an EMF document.
+type document struct {
+	metrics    []metricValue
+	dimensions map[string]string
+	properties map[string]any
+}
+
+func newDocument() *document {
+	return &document{
+		dimensions: map[string]string{},
+		properties: map[string]any{},
+	}
+}
+
+// add sorts attribute a into metrics, dimensions and properties.
+// Metrics and dimensions are taken at the root, whatever their groups.
+func (d *document) add(groups []string, a slog.Attr) {
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindLogValuer {
+		switch v := a.Value.Any().(type) {
+		case metricValue:
+			if !math.IsNaN(v.value) && !math.IsInf(v.value, 0) {
+				d.metrics = append(d.metrics, v)
+			}
+			return
+		case dimensionValue:
+			if v != "" {
+				d.dimensions[a.Key] = string(v)
+				return
+			}
+		}
+	}
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			groups = append(slices.Clip(groups), a.Key)
+		}
+		for _, ga := range v.Group() {
+			d.add(groups, ga)
+		}
+		return
+	}
+	props := d.properties
+	for _, g := range groups {
+		sub, isMap := props[g].(map[string]any)
+		if !isMap {
+			sub = map[string]any{}
+			props[g] = sub
+		}
+		props = sub
+	}
+	props[a.Key] = propertyValue(v)
+}
+
+// shadowMetrics drops metrics named like dimensions, as dimensions take
+// their root members.
+func (d *document) shadowMetrics() {
+	d.metrics = slices.DeleteFunc(d.metrics, func(m metricValue) bool {
+		_, isDim := d.dimensions[m.definition.Name]
+		return isDim
+	})
+}
+
+// render builds the EMF line for record r. Metrics shadow properties,
+// dimensions shadow both, and _aws always holds metadata.
+func (d *document) render(namespace string, r slog.Record) ([]byte, error) {
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	root := d.properties
+	root[slog.TimeKey] = t
+	root[slog.LevelKey] = r.Level.String()
+	root[slog.MessageKey] = r.Message
+
+	dimSet := slices.Sorted(maps.Keys(d.dimensions))
+	dimSetList := []emf.DimensionSet{}
+	if len(dimSet) > 0 {
+		dimSetList = []emf.DimensionSet{dimSet}
+	}
+
+	var definitions []emf.MetricDefinition
+	defined := map[string]int{} // name => index in definitions
+	for _, m := range d.metrics {
+		name := m.definition.Name
+		if i, found := defined[name]; found {
+			definitions[i] = m.definition // last value wins
+		} else {
+			defined[name] = len(definitions)
+			definitions = append(definitions, m.definition)
+		}
+		root[name] = m.value
+	}
+
+	for k, v := range d.dimensions {
+		root[k] = v
+	}
+
+	root["_aws"] = emf.Metadata{
+		Timestamp: t.UnixMilli(),
+		CloudWatchMetrics: []*emf.MetricDirective{{
+			Namespace:  namespace,
+			Dimensions: dimSetList,
+			Metrics:    definitions,
+		}},
+	}
+
+	line, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+// propertyValue converts a resolved slog value to a JSON value, the way
+// slog.JSONHandler writes it.
+func propertyValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		f := v.Float64()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return fmt.Sprint(f)
+		}
+		return f
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindDuration:
+		return int64(v.Duration())
+	case slog.KindTime:
+		return v.Time()
+	}
+	a := v.Any()
+	if err, isErr := a.(error); isErr {
+		if _, isMarshaler := a.(json.Marshaler); !isMarshaler {
+			return err.Error()
+		}
+	}
+	if _, err := json.Marshal(a); err != nil {
+		return fmt.Sprintf("!ERROR:%v", err)
+	}
+	return a
+}
@@ -0,0 +1,134 @@
+package emfslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/udhos/aws-emf/emf"
+)
+
+// go test -v -count 1 -run '^TestHandlerMetrics$' ./emf/emfslog
+func TestHandlerMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &Options{Namespace: "my-app"}))
+
+	logger = logger.With(Dimension("service", "users"), "version", "1.2.3")
+	logger.WithGroup("req").Info("request served",
+		Dimension("route", "/users"),
+		Metric(emf.MetricDefinition{Name: "latency", Unit: "Milliseconds"}, 12.5),
+		"id", "abc")
+
+	line := buf.Bytes()
+	if err := emf.Validate(line); err != nil {
+		t.Fatalf("invalid EMF: %v: %s", err, line)
+	}
+	doc, err := emf.Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Datums) != 1 {
+		t.Fatalf("expected one datum, got %+v", doc.Datums)
+	}
+	d := doc.Datums[0]
+	if d.Namespace != "my-app" || d.Metric.Name != "latency" || d.Metric.Unit != "Milliseconds" ||
+		d.Values[0] != 12.5 || d.Dimensions["service"] != "users" || d.Dimensions["route"] != "/users" {
+		t.Errorf("unexpected datum: %+v", d)
+	}
+
+	if doc.Properties["msg"] != "request served" || doc.Properties["level"] != "INFO" ||
+		doc.Properties["version"] != "1.2.3" {
+		t.Errorf("unexpected properties: %v", doc.Properties)
+	}
+	if req, _ := doc.Properties["req"].(map[string]any); req["id"] != "abc" {
+		t.Errorf("expected grouped property req.id: %v", doc.Properties)
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerPlain$' ./emf/emfslog
+func TestHandlerPlain(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, &Options{Level: slog.LevelWarn}))
+
+	logger.Info("dropped")
+	logger.Warn("plain", Dimension("route", "/users"), "n", 3)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one line, got %q", lines)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := got["_aws"]; found {
+		t.Errorf("record without metrics must not be EMF: %s", lines[0])
+	}
+	if got["msg"] != "plain" || got["route"] != "/users" || got["n"] != 3.0 {
+		t.Errorf("unexpected log line: %s", lines[0])
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerDefaultNamespace$' ./emf/emfslog
+func TestHandlerDefaultNamespace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, nil))
+
+	logger.Info("tick", Metric(emf.MetricDefinition{Name: "ticks", Unit: "Count"}, 1))
+
+	line := buf.Bytes()
+	if err := emf.Validate(line); err != nil {
+		t.Fatalf("invalid EMF: %v: %s", err, line)
+	}
+	doc, err := emf.Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns := doc.Datums[0].Namespace; ns != emf.DefaultNamespace {
+		t.Errorf("expected default namespace, got %q", ns)
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerShadowedMetrics$' ./emf/emfslog
+func TestHandlerShadowedMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, nil))
+
+	// every metric shadowed by a dimension: no metrics left
+	logger.Info("shadowed", Dimension("host", "a"), Metric(emf.MetricDefinition{Name: "host"}, 1))
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := got["_aws"]; found {
+		t.Errorf("record without metrics left must not be EMF: %s", buf.String())
+	}
+}
+
+// go test -v -count 1 -run '^TestHandlerEmptyDimension$' ./emf/emfslog
+func TestHandlerEmptyDimension(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(&buf, nil))
+
+	logger.Info("empty", Dimension("route", ""), Metric(emf.MetricDefinition{Name: "requests", Unit: "Count"}, 1))
+
+	line := buf.Bytes()
+	if err := emf.Validate(line); err != nil {
+		t.Fatalf("invalid EMF: %v: %s", err, line)
+	}
+	doc, err := emf.Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := doc.Datums[0]; len(d.Dimensions) != 0 {
+		t.Errorf("empty dimension must not be kept: %+v", d)
+	}
+	if route, found := doc.Properties["route"]; !found || route != "" {
+		t.Errorf("empty dimension must be logged as property: %v", doc.Properties)
+	}
+}
@@ -0,0 +1,168 @@
+// Package emftest provides utilities for testing code that emits EMF.
+//
+// CloudWatch is an in-memory fake that captures EMF documents, either
+// as a fake cloudwatchlogs client through PutLogEvents or as an io.Writer,
+// and extracts metric datums from them the way CloudWatch does, including
+// one datum per metric for every dimension set.
+package emftest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/udhos/aws-emf/emf"
+)
+
+// CloudWatch captures EMF documents and extracts metric datums from them.
+// A CloudWatch is safe for concurrent use.
+type CloudWatch struct {
+	datums  []emf.Datum
+	pending []byte // partial line received by Write
+	lock    sync.Mutex
+}
+
+// New creates a CloudWatch fake.
+func New() *CloudWatch {
+	return &CloudWatch{}
+}
+
+// PutLogEvents fakes method PutLogEvents from package cloudwatchlogs.
+// It fails on the first event that is not a valid EMF document.
+func (c *CloudWatch) PutLogEvents(_ context.Context,
+	params *cloudwatchlogs.PutLogEventsInput,
+	_ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+
+	for i, e := range params.LogEvents {
+		if err := c.Ingest([]byte(aws.ToString(e.Message))); err != nil {
+			return nil, fmt.Errorf("log event %d: %w", i, err)
+		}
+	}
+
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+// Write captures newline-delimited EMF documents, as written by
+// emf.Metric.Fprintln or emf.Metric.WriteTo. A line split across
+// several writes is ingested when complete. Blank lines are ignored.
+// Write implements io.Writer.
+func (c *CloudWatch) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	c.pending = append(c.pending, p...)
+	var lines [][]byte
+	for {
+		i := bytes.IndexByte(c.pending, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, bytes.Clone(c.pending[:i]))
+		c.pending = c.pending[i+1:]
+	}
+	c.lock.Unlock()
+
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := c.Ingest(line); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Ingest parses an EMF document and captures its datums.
+func (c *CloudWatch) Ingest(line []byte) error {
+	doc, err := emf.Parse(line)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.datums = append(c.datums, doc.Datums...)
+	c.lock.Unlock()
+	return nil
+}
+
+// Datums returns all captured datums, in order of arrival.
+func (c *CloudWatch) Datums() []emf.Datum {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return slices.Clone(c.datums)
+}
+
+// Reset drops all captured datums.
+func (c *CloudWatch) Reset() {
+	c.lock.Lock()
+	c.datums = nil
+	c.pending = nil
+	c.lock.Unlock()
+}
+
+// Find returns the latest datum captured for the metric name under
+// namespace and exactly the given dimensions.
+func (c *CloudWatch) Find(namespace string, dimensions map[string]string, name string) (emf.Datum, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i := len(c.datums) - 1; i >= 0; i-- {
+		d := c.datums[i]
+		if d.Namespace == namespace && d.Metric.Name == name && equalDimensions(d.Dimensions, dimensions) {
+			return d, true
+		}
+	}
+	return emf.Datum{}, false
+}
+
+// equalDimensions compares dimensions, taking nil as empty.
+func equalDimensions(a, b map[string]string) bool {
+	return len(a) == len(b) && maps.Equal(a, b)
+}
+
+// Expect describes a datum expected by Check and Require.
+type Expect struct {
+	Namespace         string
+	Dimensions        map[string]string
+	Name              string
+	Unit              string
+	StorageResolution int
+
+	// Values holds the expected values. A single value is given as
+	// a one-element slice. Nil Values are not checked.
+	Values []float64
+}
+
+// Check verifies that the latest datum captured for the expected
+// namespace, dimensions and metric name matches unit, storage resolution
+// and values.
+func (c *CloudWatch) Check(e Expect) error {
+	d, found := c.Find(e.Namespace, e.Dimensions, e.Name)
+	if !found {
+		return fmt.Errorf("datum not found: namespace=%s dimensions=%v metric=%s",
+			e.Namespace, e.Dimensions, e.Name)
+	}
+	if e.Unit != d.Metric.Unit {
+		return fmt.Errorf("metric %s unit: expected=%s got=%s", e.Name, e.Unit, d.Metric.Unit)
+	}
+	if e.StorageResolution != d.Metric.StorageResolution {
+		return fmt.Errorf("metric %s resolution: expected=%d got=%d",
+			e.Name, e.StorageResolution, d.Metric.StorageResolution)
+	}
+	if e.Values != nil && !slices.Equal(e.Values, d.Values) {
+		return fmt.Errorf("metric %s values: expected=%v got=%v", e.Name, e.Values, d.Values)
+	}
+	return nil
+}
+
+// Require is like Check, but fails the test on error.
+func (c *CloudWatch) Require(t testing.TB, e Expect) {
+	t.Helper()
+	if err := c.Check(e); err != nil {
+		t.Fatal(err)
+	}
+}
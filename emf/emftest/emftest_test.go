@@ -0,0 +1,116 @@
+package emftest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/udhos/aws-emf/emf"
+)
+
+// go test -v -count 1 -run '^TestPutLogEvents$' ./emf/emftest
+func TestPutLogEvents(t *testing.T) {
+
+	metric := emf.New(emf.Options{})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := emf.MetricDefinition{
+		Name:              "speed1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns2", metric1, nil, 50)
+
+	cw := New()
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: metric.CloudWatchLogEvents(),
+	}
+	if _, err := cw.PutLogEvents(context.TODO(), input); err != nil {
+		t.Fatalf("PutLogEvents error: %v", err)
+	}
+
+	cw.Require(t, Expect{
+		Namespace:         "emf-test-ns1",
+		Dimensions:        dim1,
+		Name:              "speed1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+		Values:            []float64{100},
+	})
+	cw.Require(t, Expect{
+		Namespace:         "emf-test-ns2",
+		Name:              "speed1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+		Values:            []float64{50},
+	})
+
+	if err := cw.Check(Expect{Namespace: "emf-test-ns1", Name: "speed1"}); err == nil {
+		t.Errorf("expected error for missing dimensions")
+	}
+	if err := cw.Check(Expect{Namespace: "emf-test-ns2", Name: "speed1", Unit: "Count"}); err == nil {
+		t.Errorf("expected error for wrong unit")
+	}
+	if err := cw.Check(Expect{Namespace: "emf-test-ns2", Name: "speed1",
+		Unit: "Bytes/Second", StorageResolution: 1, Values: []float64{51}}); err == nil {
+		t.Errorf("expected error for wrong value")
+	}
+}
+
+// go test -v -count 1 -run '^TestPutLogEventsInvalid$' ./emf/emftest
+func TestPutLogEventsInvalid(t *testing.T) {
+	cw := New()
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogEvents: []types.InputLogEvent{{Message: aws.String(`{"m":1}`)}},
+	}
+	if _, err := cw.PutLogEvents(context.TODO(), input); !errors.Is(err, emf.ErrMissingMetadata) {
+		t.Fatalf("expected missing metadata error, got: %v", err)
+	}
+}
+
+// go test -v -count 1 -run '^TestWriter$' ./emf/emftest
+func TestWriter(t *testing.T) {
+
+	cw := New()
+
+	const line = `{"_aws":{"Timestamp":0,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[["a"],["a","b"]],"Metrics":[{"Name":"m","Unit":"Count"}]}]},"a":"1","b":"2","m":[1,2]}`
+
+	// line split across writes
+	if _, err := cw.Write([]byte(line[:10])); err != nil {
+		t.Fatal(err)
+	}
+	if len(cw.Datums()) != 0 {
+		t.Fatalf("partial line must not be ingested")
+	}
+	if _, err := cw.Write([]byte(line[10:] + "\n\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// every dimension set is extracted
+	cw.Require(t, Expect{Namespace: "ns", Dimensions: map[string]string{"a": "1"},
+		Name: "m", Unit: "Count", Values: []float64{1, 2}})
+	cw.Require(t, Expect{Namespace: "ns", Dimensions: map[string]string{"a": "1", "b": "2"},
+		Name: "m", Unit: "Count", Values: []float64{1, 2}})
+
+	if len(cw.Datums()) != 2 {
+		t.Fatalf("datums: expected=2 got=%d", len(cw.Datums()))
+	}
+
+	cw.Reset()
+
+	metric := emf.New(emf.Options{Namespace: "ns"})
+	metric.RecordDefault(emf.MetricDefinition{Name: "m"}, nil, 3)
+	metric.Fprintln(cw)
+
+	cw.Require(t, Expect{Namespace: "ns", Name: "m", Values: []float64{3}})
+
+	if _, err := cw.Write([]byte("not json\n")); err == nil {
+		t.Fatalf("expected error for invalid line")
+	}
+}
@@ -0,0 +1,55 @@
+package emf
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// encodeBuffer holds scratch space reused for encoding EMF lines.
+type encodeBuffer struct {
+	line  []byte
+	names []string
+}
+
+// bufferPool holds buffers reused for encoding EMF lines.
+var bufferPool = sync.Pool{
+	New: func() any { return new(encodeBuffer) },
+}
+
+// encode renders every context as one EMF line terminated by newline.
+// Each line is encoded into a pooled buffer and handed to fn, which must
+// not retain the line after returning. An error returned by fn stops
+// the encoding.
+func (m *Metric) encode(t int64, fn func(line []byte) error) error {
+	m.Collect()
+	buf := bufferPool.Get().(*encodeBuffer)
+	defer bufferPool.Put(buf)
+	for _, s := range m.snapshot(t) {
+		buf.line, buf.names = appendDocument(buf.line[:0], s, buf.names)
+		buf.line = append(buf.line, '\n')
+		if err := fn(buf.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo writes EMF metric to w, one line per context, streaming each
+// line straight into w without building the full output in memory.
+// Wrap w with bufio.Writer to reduce the number of writes.
+// WriteTo implements io.WriterTo.
+func (m *Metric) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	err := m.encode(m.options.UnixMilli(), func(line []byte) error {
+		n, err := w.Write(line)
+		total += int64(n)
+		return err
+	})
+	return total, err
+}
+
+// trimNewline removes the line terminator added by encode.
+func trimNewline(line []byte) []byte {
+	return bytes.TrimSuffix(line, []byte{'\n'})
+}
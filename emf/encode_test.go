@@ -0,0 +1,89 @@
+package emf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestMetricWithContexts(contexts int) *Metric {
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+	metric1 := MetricDefinition{Name: "speed1", Unit: "Count"}
+	for i := range contexts {
+		metric.Record("emf-test-ns1", metric1, map[string]string{"host": fmt.Sprintf("host%d", i)}, i)
+	}
+	return metric
+}
+
+// go test -v -count 1 -run '^TestWriteTo$' ./emf
+func TestWriteTo(t *testing.T) {
+
+	metric := newTestMetricWithContexts(10)
+
+	var buf bytes.Buffer
+	n, err := metric.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo error: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo count: expected=%d got=%d", buf.Len(), n)
+	}
+
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	expect := metric.Render()
+	slices.Sort(got)
+	slices.Sort(expect)
+
+	if !slices.Equal(expect, got) {
+		t.Fatalf("expected=%v got=%v", expect, got)
+	}
+
+	var out bytes.Buffer
+	metric.Fprintln(&out)
+	if out.Len() != buf.Len() {
+		t.Fatalf("Fprintln size: expected=%d got=%d", buf.Len(), out.Len())
+	}
+}
+
+type failWriter struct {
+	writes int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, errors.New("write failure")
+}
+
+// go test -v -count 1 -run '^TestWriteToError$' ./emf
+func TestWriteToError(t *testing.T) {
+
+	metric := newTestMetricWithContexts(10)
+
+	var w failWriter
+	if _, err := metric.WriteTo(&w); err == nil {
+		t.Fatalf("expected error")
+	}
+	if w.writes != 1 {
+		t.Fatalf("encoding must stop at first error: writes=%d", w.writes)
+	}
+}
+
+// go test -bench '^BenchmarkWriteTo$' -benchmem -run '^$' ./emf
+func BenchmarkWriteTo(b *testing.B) {
+	metric := newTestMetricWithContexts(1000)
+	for range b.N {
+		metric.WriteTo(io.Discard)
+	}
+}
+
+// go test -bench '^BenchmarkRender$' -benchmem -run '^$' ./emf
+func BenchmarkRender(b *testing.B) {
+	metric := newTestMetricWithContexts(1000)
+	for range b.N {
+		metric.Render()
+	}
+}
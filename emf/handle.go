@@ -0,0 +1,76 @@
+package emf
+
+import (
+	"maps"
+	"slices"
+)
+
+// Handle is a metric pre-bound to a namespace, a MetricDefinition and
+// a fixed set of dimensions. Recording through a Handle skips dimension
+// key computation and directive lookup, which makes it suitable for
+// hot paths. A Handle is safe for concurrent use.
+type Handle struct {
+	metric     *Metric
+	namespace  string
+	definition MetricDefinition
+	dimensions map[string]string
+	dimKey     []byte
+	keys       []string
+	shard      *shard
+
+	// context and generation are guarded by shard.lock.
+	context    *metricContext
+	generation uint64
+}
+
+// Handle creates a handle for recording the metric under namespace and
+// dimensions. The dimensions map is copied, so the caller is free to
+// modify it afterwards.
+func (m *Metric) Handle(namespace string, metric MetricDefinition, dimensions map[string]string) *Handle {
+	var kb keyBuffer
+	dimKey, keys := kb.compute(namespace, dimensions)
+	return &Handle{
+		metric:     m,
+		namespace:  namespace,
+		definition: metric,
+		dimensions: maps.Clone(dimensions),
+		dimKey:     slices.Clone(dimKey),
+		keys:       slices.Clone(keys),
+		shard:      m.getShard(dimKey),
+	}
+}
+
+// HandleDefault creates a handle for recording the metric under
+// the default namespace Options.Namespace.
+func (m *Metric) HandleDefault(metric MetricDefinition, dimensions map[string]string) *Handle {
+	return m.Handle(m.options.Namespace, metric, dimensions)
+}
+
+// Record records a value for the handle metric.
+func (h *Handle) Record(value int) {
+	m := h.metric
+	if m == nil {
+		return // no-op handle
+	}
+	sh := h.shard
+	sh.lock.Lock()
+	c := h.resolve()
+	c.values[h.definition.Name] = intValue(value)
+	m.touch(c)
+	sh.lock.Unlock()
+}
+
+// resolve returns the context bound to the handle, defining the metric
+// again whenever the context has been dropped from the table since the
+// last call, for instance by Reset. Caller must hold shard.lock.
+func (h *Handle) resolve() *metricContext {
+	sh := h.shard
+	if h.context != nil && h.generation == sh.generation {
+		return h.context
+	}
+	c := sh.getContext(h.namespace, h.dimensions, h.dimKey, h.keys)
+	c.defineMetric(h.definition)
+	h.context = c
+	h.generation = sh.generation
+	return c
+}
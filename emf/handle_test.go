@@ -0,0 +1,130 @@
+package emf
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+)
+
+// go test -v -count 1 -run '^TestHandle$' ./emf
+func TestHandle(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := MetricDefinition{
+		Name:              "speed1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+	}
+
+	h := metric.Handle("emf-test-ns1", metric1, dim1)
+
+	if list := metric.Render(); len(list) != 0 {
+		t.Fatalf("handle creation should not define metric: %v", list)
+	}
+
+	h.Record(100)
+	h.Record(110)
+
+	// recording through handle must match recording through Metric
+	other := New(Options{UnixMilli: func() int64 { return 0 }})
+	other.Record("emf-test-ns1", metric1, dim1, 110)
+
+	got := metric.Render()
+	expect := other.Render()
+	if len(got) != 1 || got[0] != expect[0] {
+		t.Fatalf("expected=%v got=%v", expect, got)
+	}
+
+	cw := newCloudWatchMock()
+	input := &cloudwatchlogs.PutLogEventsInput{}
+	input.LogEvents = metric.CloudWatchLogEvents()
+	_, err := cw.PutLogEvents(context.TODO(), input)
+	if err != nil {
+		t.Fatalf("PutLogEvents error: %v", err)
+	}
+	if errRequire := cw.require(requireMetric{
+		namespace:        "emf-test-ns1",
+		dimensions:       dim1,
+		metricName:       "speed1",
+		metricUnit:       "Bytes/Second",
+		metricResolution: 1,
+		metricValue:      110,
+	}); errRequire != nil {
+		t.Fatalf("require error: %v", errRequire)
+	}
+}
+
+// go test -v -count 1 -run '^TestHandleAfterReset$' ./emf
+func TestHandleAfterReset(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	h := metric.Handle("emf-test-ns1", metric1, dim1)
+	h.Record(100)
+
+	metric.Reset()
+
+	if list := metric.Render(); len(list) != 0 {
+		t.Fatalf("expected empty after reset: %v", list)
+	}
+
+	h.Record(200)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["dimKey1"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"dimKey1":"dimVal1","speed1":200}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestHandleDefault$' ./emf
+func TestHandleDefault(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return 0 },
+		Namespace: "emf-test-default",
+	})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	metric.HandleDefault(metric1, nil).Record(100)
+
+	const expect = `{"_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-default","Dimensions":[],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":100}`
+	list := metric.Render()
+	if len(list) != 1 || list[0] != expect {
+		t.Fatalf("expected=%s got=%v", expect, list)
+	}
+}
+
+// go test -bench '^BenchmarkRecord$' -benchmem -run '^$' ./emf
+func BenchmarkRecord(b *testing.B) {
+	metric := New(Options{})
+	dim := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2", "dimKey3": "dimVal3"}
+	metric1 := MetricDefinition{Name: "speed1"}
+	for i := range b.N {
+		metric.Record("emf-test-ns1", metric1, dim, i)
+	}
+}
+
+// go test -bench '^BenchmarkHandleRecord$' -benchmem -run '^$' ./emf
+func BenchmarkHandleRecord(b *testing.B) {
+	metric := New(Options{})
+	dim := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2", "dimKey3": "dimVal3"}
+	metric1 := MetricDefinition{Name: "speed1"}
+	h := metric.Handle("emf-test-ns1", metric1, dim)
+	for i := range b.N {
+		h.Record(i)
+	}
+}
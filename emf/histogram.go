@@ -0,0 +1,58 @@
+package emf
+
+import "math"
+
+// HistogramValues expands histogram buckets into at most
+// MaxValuesPerMetric values for RecordValues, so that CloudWatch can
+// compute approximate percentiles of the distribution.
+//
+// boundaries holds len(counts)+1 bucket boundaries in increasing order:
+// bucket i spans boundaries[i] to boundaries[i+1]. A bucket is
+// represented by its midpoint, or by its finite boundary when the other
+// one is infinite. When counts add up to more than MaxValuesPerMetric,
+// buckets get values in proportion to their counts.
+func HistogramValues(boundaries []float64, counts []uint64) []float64 {
+	if len(boundaries) != len(counts)+1 {
+		return nil
+	}
+
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return nil
+	}
+	limit := min(total, MaxValuesPerMetric)
+
+	values := make([]float64, 0, limit)
+	var cumulative uint64
+	var emitted int
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		cumulative += c
+		// cumulative rounding keeps the total exactly at limit
+		target := int(math.Round(float64(cumulative) * float64(limit) / float64(total)))
+		v := bucketValue(boundaries[i], boundaries[i+1])
+		for ; emitted < target; emitted++ {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// bucketValue picks the value representing the bucket from lower to upper.
+func bucketValue(lower, upper float64) float64 {
+	switch {
+	case math.IsInf(lower, -1) && math.IsInf(upper, 1):
+		return 0
+	case math.IsInf(lower, -1):
+		return upper
+	case math.IsInf(upper, 1):
+		return lower
+	}
+	return lower + (upper-lower)/2
+}
@@ -0,0 +1,72 @@
+package emf
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestHistogramValues$' ./emf
+func TestHistogramValues(t *testing.T) {
+	inf := math.Inf(1)
+
+	table := []struct {
+		name       string
+		boundaries []float64
+		counts     []uint64
+		expect     []float64
+	}{
+		{
+			name:       "midpoints",
+			boundaries: []float64{0, 1, 3},
+			counts:     []uint64{2, 1},
+			expect:     []float64{0.5, 0.5, 2},
+		},
+		{
+			name:       "infinite bounds",
+			boundaries: []float64{-inf, 1, inf},
+			counts:     []uint64{1, 1},
+			expect:     []float64{1, 1},
+		},
+		{
+			name:       "empty",
+			boundaries: []float64{0, 1},
+			counts:     []uint64{0},
+			expect:     nil,
+		},
+		{
+			name:       "mismatch",
+			boundaries: []float64{0},
+			counts:     []uint64{1},
+			expect:     nil,
+		},
+	}
+
+	for _, data := range table {
+		t.Run(data.name, func(t *testing.T) {
+			got := HistogramValues(data.boundaries, data.counts)
+			if !slices.Equal(got, data.expect) {
+				t.Errorf("expected=%v got=%v", data.expect, got)
+			}
+		})
+	}
+}
+
+// go test -v -count 1 -run '^TestHistogramValuesScaled$' ./emf
+func TestHistogramValuesScaled(t *testing.T) {
+	boundaries := []float64{0, 10, 20, 30}
+	counts := []uint64{1000, 3000, 6000}
+
+	values := HistogramValues(boundaries, counts)
+	if len(values) != MaxValuesPerMetric {
+		t.Fatalf("expected %d values, got %d", MaxValuesPerMetric, len(values))
+	}
+
+	n := map[float64]int{}
+	for _, v := range values {
+		n[v]++
+	}
+	if n[5] != 10 || n[15] != 30 || n[25] != 60 {
+		t.Errorf("values not proportional to counts: %v", n)
+	}
+}
@@ -0,0 +1,51 @@
+// Package delta converts cumulative values, like counters, into
+// increases between collections.
+package delta
+
+// Tracker remembers the last value of cumulative series.
+// Tracker is not safe for concurrent use.
+type Tracker[K comparable] struct {
+	last  map[K]entry
+	epoch uint64
+}
+
+type entry struct {
+	value float64
+	epoch uint64 // sweep epoch of the last update
+}
+
+// New creates a Tracker.
+func New[K comparable]() *Tracker[K] {
+	return &Tracker[K]{last: map[K]entry{}}
+}
+
+// Delta returns the increase of series key since its previous value.
+// The first value of a series is returned in full, and a decrease is
+// taken as a reset, returning current.
+func (t *Tracker[K]) Delta(key K, current float64) float64 {
+	previous, found := t.last[key]
+	t.last[key] = entry{value: current, epoch: t.epoch}
+	if !found || current < previous.value {
+		return current
+	}
+	return current - previous.value
+}
+
+// Sweep forgets the series not updated since the previous Sweep,
+// and returns how many were forgotten.
+func (t *Tracker[K]) Sweep() int {
+	var removed int
+	for k, e := range t.last {
+		if e.epoch != t.epoch {
+			delete(t.last, k)
+			removed++
+		}
+	}
+	t.epoch++
+	return removed
+}
+
+// Len returns the number of series tracked.
+func (t *Tracker[K]) Len() int {
+	return len(t.last)
+}
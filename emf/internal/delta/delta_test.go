@@ -0,0 +1,38 @@
+package delta
+
+import "testing"
+
+// go test -v -count 1 -run '^TestTracker$' ./emf/internal/delta
+func TestTracker(t *testing.T) {
+	tracker := New[string]()
+
+	steps := []struct {
+		key     string
+		current float64
+		expect  float64
+	}{
+		{"a", 5, 5}, // first value in full
+		{"a", 7, 2}, // increase
+		{"a", 7, 0}, // unchanged
+		{"a", 3, 3}, // reset
+		{"b", 1, 1},
+	}
+	for i, s := range steps {
+		if got := tracker.Delta(s.key, s.current); got != s.expect {
+			t.Errorf("step %d: Delta(%s, %v): expected=%v got=%v", i, s.key, s.current, s.expect, got)
+		}
+	}
+
+	if removed := tracker.Sweep(); removed != 0 {
+		t.Errorf("first sweep must keep series updated since creation, removed %d", removed)
+	}
+
+	tracker.Delta("a", 4)
+
+	if removed := tracker.Sweep(); removed != 1 || tracker.Len() != 1 {
+		t.Errorf("expected b swept, removed=%d len=%d", removed, tracker.Len())
+	}
+	if got := tracker.Delta("b", 2); got != 2 {
+		t.Errorf("swept series must restart in full, got %v", got)
+	}
+}
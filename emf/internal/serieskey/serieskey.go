@@ -0,0 +1,36 @@
+// Package serieskey builds keys identifying metric series. Every string
+// is length-prefixed, so that distinct series never produce the same
+// key, whatever characters they hold.
+package serieskey
+
+import (
+	"encoding/binary"
+	"maps"
+	"slices"
+)
+
+// AppendString appends the length-prefixed s to b.
+func AppendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// AppendDimensions appends dimension names and values to b, in name
+// order.
+func AppendDimensions(b []byte, dimensions map[string]string) []byte {
+	for _, k := range slices.Sorted(maps.Keys(dimensions)) {
+		b = AppendString(b, k)
+		b = AppendString(b, dimensions[k])
+	}
+	return b
+}
+
+// Key returns the key of parts followed by dimensions. Callers must
+// pass the same number of parts for all keys compared.
+func Key(dimensions map[string]string, parts ...string) string {
+	var b []byte
+	for _, p := range parts {
+		b = AppendString(b, p)
+	}
+	return string(AppendDimensions(b, dimensions))
+}
@@ -0,0 +1,21 @@
+package serieskey
+
+import "testing"
+
+// go test -v -count 1 -run '^TestKey$' ./emf/internal/serieskey
+func TestKey(t *testing.T) {
+	if Key(map[string]string{"b": "2", "a": "1"}, "ns") != Key(map[string]string{"a": "1", "b": "2"}, "ns") {
+		t.Errorf("key must not depend on map order")
+	}
+
+	distinct := [][2]string{
+		{Key(map[string]string{"a": "b\x00c=d"}), Key(map[string]string{"a": "b", "c": "d"})},
+		{Key(nil, "ns a", "m"), Key(nil, "ns", "a m")},
+		{Key(map[string]string{"a": "1"}, "ns"), Key(map[string]string{"a": "1", "": ""}, "ns")},
+	}
+	for i, d := range distinct {
+		if d[0] == d[1] {
+			t.Errorf("case %d: distinct series share key %q", i, d[0])
+		}
+	}
+}
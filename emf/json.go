@@ -0,0 +1,230 @@
+package emf
+
+import (
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// This file implements a purpose-built JSON encoder for EMF documents.
+// It writes the document from the typed Metadata, values and dimensions
+// without reflection, producing exactly the same bytes encoding/json
+// produces for the equivalent map[string]any: members sorted by name,
+// HTML characters escaped and invalid UTF-8 replaced by U+FFFD.
+
+// appendDocument appends the EMF document for the snapshot s to b.
+// names is scratch space for sorting member names, returned for reuse.
+// A dimension shadows a metric value with the same name, both shadow
+// a property, and _aws always holds metadata.
+func appendDocument(b []byte, s contextSnapshot, names []string) ([]byte, []string) {
+	names = append(names[:0], metadataMember)
+	for k := range s.dimensions {
+		if k != metadataMember {
+			names = append(names, k)
+		}
+	}
+	for k := range s.values {
+		if _, isDim := s.dimensions[k]; !isDim && k != metadataMember {
+			names = append(names, k)
+		}
+	}
+	for k := range s.properties {
+		_, isDim := s.dimensions[k]
+		_, isValue := s.values[k]
+		if !isDim && !isValue && k != metadataMember {
+			names = append(names, k)
+		}
+	}
+	slices.Sort(names)
+
+	b = append(b, '{')
+	for i, name := range names {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, name)
+		b = append(b, ':')
+		if name == metadataMember {
+			b = appendMetadata(b, s.meta)
+			continue
+		}
+		if v, isDim := s.dimensions[name]; isDim {
+			b = appendJSONString(b, v)
+			continue
+		}
+		if v, isValue := s.values[name]; isValue {
+			b = appendValue(b, v)
+			continue
+		}
+		b = appendJSONString(b, s.properties[name])
+	}
+	b = append(b, '}')
+
+	return b, names
+}
+
+// metadataMember is the root member holding EMF metadata.
+const metadataMember = "_aws"
+
+func appendMetadata(b []byte, meta *Metadata) []byte {
+	b = append(b, `{"CloudWatchMetrics":`...)
+	if meta.CloudWatchMetrics == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, dir := range meta.CloudWatchMetrics {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendMetricDirective(b, dir)
+		}
+		b = append(b, ']')
+	}
+	b = append(b, `,"Timestamp":`...)
+	b = strconv.AppendInt(b, meta.Timestamp, 10)
+	b = append(b, '}')
+	return b
+}
+
+func appendMetricDirective(b []byte, dir *MetricDirective) []byte {
+	if dir == nil {
+		return append(b, "null"...)
+	}
+
+	b = append(b, `{"Namespace":`...)
+	b = appendJSONString(b, dir.Namespace)
+
+	b = append(b, `,"Dimensions":`...)
+	if dir.Dimensions == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, set := range dir.Dimensions {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendStringArray(b, set)
+		}
+		b = append(b, ']')
+	}
+
+	b = append(b, `,"Metrics":`...)
+	if dir.Metrics == nil {
+		b = append(b, "null"...)
+	} else {
+		b = append(b, '[')
+		for i, md := range dir.Metrics {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendMetricDefinition(b, md)
+		}
+		b = append(b, ']')
+	}
+
+	b = append(b, '}')
+	return b
+}
+
+func appendMetricDefinition(b []byte, md MetricDefinition) []byte {
+	b = append(b, `{"Name":`...)
+	b = appendJSONString(b, md.Name)
+	if md.Unit != "" {
+		b = append(b, `,"Unit":`...)
+		b = appendJSONString(b, md.Unit)
+	}
+	if md.StorageResolution != 0 {
+		b = append(b, `,"StorageResolution":`...)
+		b = strconv.AppendInt(b, int64(md.StorageResolution), 10)
+	}
+	b = append(b, '}')
+	return b
+}
+
+func appendStringArray(b []byte, list []string) []byte {
+	if list == nil {
+		return append(b, "null"...)
+	}
+	b = append(b, '[')
+	for i, s := range list {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, s)
+	}
+	b = append(b, ']')
+	return b
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends s as JSON string, escaping exactly like
+// encoding/json with HTML escaping enabled. Invalid UTF-8 bytes are
+// replaced by the escape \ufffd, as written by encoding/json up to
+// Go 1.24, the minimum version of this module (encoding/json backed by
+// the json/v2 implementation writes the literal U+FFFD character).
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if !needsEscape(c) {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			b = appendEscapedByte(b, c)
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	b = append(b, '"')
+	return b
+}
+
+// needsEscape reports whether the ASCII byte c must be escaped in a JSON
+// string, HTML characters included.
+func needsEscape(c byte) bool {
+	switch c {
+	case '"', '\\', '<', '>', '&':
+		return true
+	}
+	return c < 0x20
+}
+
+// appendEscapedByte appends the JSON escape of the ASCII byte c.
+func appendEscapedByte(b []byte, c byte) []byte {
+	switch c {
+	case '\\', '"':
+		return append(b, '\\', c)
+	case '\b':
+		return append(b, '\\', 'b')
+	case '\f':
+		return append(b, '\\', 'f')
+	case '\n':
+		return append(b, '\\', 'n')
+	case '\r':
+		return append(b, '\\', 'r')
+	case '\t':
+		return append(b, '\\', 't')
+	}
+	return append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+}
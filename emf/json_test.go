@@ -0,0 +1,224 @@
+package emf
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"unicode/utf8"
+)
+
+// referenceDocument builds the EMF document the way the package used to,
+// as map[string]any marshaled by encoding/json. The hand-rolled encoder
+// must match its output byte for byte.
+func referenceDocument(s contextSnapshot) map[string]any {
+	doc := make(map[string]any, len(s.values)+len(s.dimensions)+len(s.properties)+1)
+	for k, v := range s.properties {
+		doc[k] = v
+	}
+	for k, v := range s.values {
+		doc[k] = referenceValue(v)
+	}
+	for k, v := range s.dimensions {
+		doc[k] = v
+	}
+	doc["_aws"] = s.meta
+	return doc
+}
+
+func referenceValue(v value) any {
+	switch v.kind {
+	case valueFloat:
+		return v.f
+	case valueArray:
+		return v.values
+	}
+	return v.i
+}
+
+func requireSameEncoding(t *testing.T, s contextSnapshot) {
+	t.Helper()
+	expect, err := json.Marshal(referenceDocument(s))
+	if err != nil {
+		t.Fatalf("json marshal: %v", err)
+	}
+	got, _ := appendDocument(nil, s, nil)
+	if string(expect) != string(got) {
+		t.Fatalf("encoding mismatch:\nexpected=%s\ngot=     %s", expect, got)
+	}
+}
+
+// go test -v -count 1 -run '^TestEncoderMatchesEncodingJSON$' ./emf
+func TestEncoderMatchesEncodingJSON(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 1700000000000 }})
+
+	metric.Record("emf-test-ns1", MetricDefinition{Name: "speed1"}, nil, 100)
+	metric.Record("emf-test-ns1", MetricDefinition{Name: "speed2", Unit: "Bytes/Second", StorageResolution: 1}, nil, -5)
+	metric.Record("emf-test-ns1", MetricDefinition{Name: "speed1"}, map[string]string{"Operation": "GetUser", "host": "a"}, 7)
+	metric.Record("emf-test-<ns>&", MetricDefinition{Name: "lat\"ency\\"}, map[string]string{"path": "/a?b=<c>&d\n"}, 1)
+
+	// dimension shadows metric with same name, _aws always holds metadata
+	metric.Record("emf-test-ns2", MetricDefinition{Name: "host"}, map[string]string{"host": "a", "_aws": "x"}, 1)
+	metric.Record("emf-test-ns3", MetricDefinition{Name: "_aws"}, nil, 1)
+
+	// dimensions and values shadow properties
+	requireSameEncoding(t, contextSnapshot{
+		meta:       &Metadata{},
+		values:     map[string]value{"v": intValue(1), "both": intValue(2)},
+		dimensions: map[string]string{"d": "x", "both": "y"},
+		properties: map[string]string{"p": "<z>", "v": "1", "d": "2", "both": "3", "_aws": "4"},
+	})
+
+	for _, s := range metric.snapshot(0) {
+		requireSameEncoding(t, s)
+	}
+
+	// nil slices
+	requireSameEncoding(t, contextSnapshot{meta: &Metadata{}})
+	requireSameEncoding(t, contextSnapshot{meta: &Metadata{
+		CloudWatchMetrics: []*MetricDirective{{Namespace: "ns"}, nil},
+	}})
+	requireSameEncoding(t, contextSnapshot{meta: &Metadata{
+		CloudWatchMetrics: []*MetricDirective{{Namespace: "ns", Dimensions: []DimensionSet{nil}}},
+	}})
+}
+
+// go test -v -count 1 -run '^TestEncoderFloats$' ./emf
+func TestEncoderFloats(t *testing.T) {
+
+	floats := []float64{
+		0, math.Copysign(0, -1), 1, -1, 0.1, 1.5, 1e-6, 1e-7, 9.99e-7, 123456789.125,
+		1e20, 1e21, -1e21, 1.7976931348623157e308, 5e-324,
+	}
+	r := rand.New(rand.NewSource(1))
+	for range 1000 {
+		if f := math.Float64frombits(r.Uint64()); finite(f) {
+			floats = append(floats, f)
+		}
+	}
+
+	for i, f := range floats {
+		requireSameEncoding(t, contextSnapshot{
+			meta:   &Metadata{},
+			values: map[string]value{"f": floatValue(f), "a": arrayValue(floats[:i])},
+		})
+	}
+}
+
+// encoderAlphabet holds every character class escaped by encoding/json.
+var encoderAlphabet = []string{
+	"a", "Z", "_", "é", "日", "\"", "\\", "<", ">", "&", "\b", "\f", "\n", "\r", "\t",
+	"\x00", "\x1f", "\x7f", "\u2028", "\u2029",
+}
+
+func randomEncoderString(r *rand.Rand) string {
+	var s string
+	for range r.Intn(5) {
+		s += encoderAlphabet[r.Intn(len(encoderAlphabet))]
+	}
+	return s
+}
+
+// go test -v -count 1 -run '^TestEncoderProperty$' ./emf
+func TestEncoderProperty(t *testing.T) {
+
+	property := func(namespace string, dimensions map[string]string, metrics []MetricDefinition, values []int) bool {
+		metric := New(Options{UnixMilli: func() int64 { return 0 }})
+		for i, md := range metrics {
+			metric.Record(namespace, md, dimensions, values[i])
+		}
+		for _, s := range metric.snapshot(int64(len(values))) {
+			expect, err := json.Marshal(referenceDocument(s))
+			if err != nil {
+				return false
+			}
+			got, _ := appendDocument(nil, s, nil)
+			if string(expect) != string(got) {
+				t.Logf("expected=%s got=%s", expect, got)
+				return false
+			}
+		}
+		return true
+	}
+
+	config := &quick.Config{
+		MaxCount: 5000,
+		Values: func(args []reflect.Value, r *rand.Rand) {
+			dimensions := map[string]string{}
+			for range r.Intn(4) {
+				dimensions[randomEncoderString(r)] = randomEncoderString(r)
+			}
+			var metrics []MetricDefinition
+			var values []int
+			for range 1 + r.Intn(4) {
+				metrics = append(metrics, MetricDefinition{
+					Name:              randomEncoderString(r),
+					Unit:              randomEncoderString(r),
+					StorageResolution: r.Intn(3) - 1,
+				})
+				values = append(values, r.Int()-r.Int())
+			}
+			args[0] = reflect.ValueOf(randomEncoderString(r))
+			args[1] = reflect.ValueOf(dimensions)
+			args[2] = reflect.ValueOf(metrics)
+			args[3] = reflect.ValueOf(values)
+		},
+	}
+
+	if err := quick.Check(property, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -v -count 1 -run '^TestEncoderInvalidUTF8$' ./emf
+func TestEncoderInvalidUTF8(t *testing.T) {
+
+	// encoding/json output for invalid UTF-8 differs among Go releases,
+	// hence the output of Go 1.24, the module minimum, is expected.
+
+	table := []struct {
+		input  string
+		expect string
+	}{
+		{"\xff", `"\ufffd"`},
+		{"a\xe2\x80b", `"a\ufffd\ufffdb"`},
+		{"\xed\xa0\x80", `"\ufffd\ufffd\ufffd"`},
+		{"日\x80<", `"日\ufffd\u003c"`},
+	}
+	for _, data := range table {
+		got := appendJSONString(nil, data.input)
+		if string(got) != data.expect {
+			t.Errorf("input=%q expected=%s got=%s", data.input, data.expect, got)
+		}
+		var decoded string
+		if err := json.Unmarshal(got, &decoded); err != nil {
+			t.Fatalf("unmarshal %q: %v", got, err)
+		}
+		if !utf8.ValidString(decoded) {
+			t.Errorf("invalid UTF-8 decoded: %q", decoded)
+		}
+	}
+}
+
+// go test -bench '^BenchmarkEncoder$' -benchmem -run '^$' ./emf
+func BenchmarkEncoder(b *testing.B) {
+	metric := newTestMetricWithContexts(1)
+	s := metric.snapshot(0)[0]
+	var line []byte
+	var names []string
+	for range b.N {
+		line, names = appendDocument(line[:0], s, names)
+	}
+}
+
+// go test -bench '^BenchmarkEncodingJSON$' -benchmem -run '^$' ./emf
+func BenchmarkEncodingJSON(b *testing.B) {
+	metric := newTestMetricWithContexts(1)
+	s := metric.snapshot(0)[0]
+	for range b.N {
+		json.Marshal(referenceDocument(s))
+	}
+}
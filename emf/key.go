@@ -0,0 +1,51 @@
+package emf
+
+import (
+	"slices"
+
+	"github.com/udhos/aws-emf/emf/internal/serieskey"
+)
+
+// keyBuffer holds scratch space for computing dimension keys without
+// allocating. A keyBuffer is meant to be declared as a local variable,
+// so that it lives on the caller's stack. Keys exceeding the buffer
+// sizes are still computed correctly, on the heap.
+type keyBuffer struct {
+	keys [30]string // CloudWatch accepts up to 30 dimensions per DimensionSet
+	key  [256]byte
+}
+
+// compute returns the dimension key for namespace and dimensions, along
+// with the sorted dimension names. The results point into kb whenever
+// they fit, hence they are valid only while kb is alive.
+func (kb *keyBuffer) compute(namespace string, dimensions map[string]string) (dimKey []byte, keys []string) {
+	keys = kb.keys[:0]
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	dimKey = appendDimensionKey(kb.key[:0], namespace, dimensions, keys)
+	return dimKey, keys
+}
+
+// appendDimensionKey appends to b the key identifying the context for
+// namespace and dimensions. keys must hold the sorted dimension names.
+// Every string is length-prefixed, so that distinct namespaces or
+// dimensions never produce the same key, whatever characters they hold.
+func appendDimensionKey(b []byte, namespace string, dimensions map[string]string, keys []string) []byte {
+	b = serieskey.AppendString(b, namespace)
+	for _, k := range keys {
+		b = serieskey.AppendString(b, k)
+		b = serieskey.AppendString(b, dimensions[k])
+	}
+	return b
+}
+
+// getDimensionKey returns the key identifying the context for namespace
+// and dimensions. It is the allocating counterpart of keyBuffer.compute,
+// meant for code paths that are not performance sensitive.
+func getDimensionKey(namespace string, dimensions map[string]string) string {
+	var kb keyBuffer
+	dimKey, _ := kb.compute(namespace, dimensions)
+	return string(dimKey)
+}
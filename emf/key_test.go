@@ -0,0 +1,147 @@
+package emf
+
+import (
+	"maps"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// go test -v -count 1 -run '^TestDimensionKeyOrder$' ./emf
+func TestDimensionKeyOrder(t *testing.T) {
+	expect := getDimensionKey("ns1", map[string]string{"a": "1", "b": "2", "c": "3"})
+	for range 10 {
+		dim := map[string]string{"c": "3", "b": "2", "a": "1"}
+		if got := getDimensionKey("ns1", dim); got != expect {
+			t.Fatalf("expected=%q got=%q", expect, got)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestDimensionKeyAmbiguity$' ./emf
+func TestDimensionKeyAmbiguity(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 0 }})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	// both would render as "a:b,c:d" with naive separators
+	metric.Record("ns1", metric1, map[string]string{"a": "b,c:d"}, 1)
+	metric.Record("ns1", metric1, map[string]string{"a": "b", "c": "d"}, 2)
+
+	// namespace and dimensions must not merge either
+	metric.Record("ns1 a", metric1, map[string]string{"b": "c"}, 3)
+	metric.Record("ns1", metric1, map[string]string{"a b": "c"}, 4)
+
+	if list := metric.Render(); len(list) != 4 {
+		t.Fatalf("list size: expected=4 got=%d: %v", len(list), list)
+	}
+}
+
+// keyAlphabet is small and full of separators, so that random strings
+// are likely to collide under a naive key encoding.
+const keyAlphabet = "ab:, \x00\x01"
+
+func randomKeyString(r *rand.Rand) string {
+	b := make([]byte, r.Intn(4))
+	for i := range b {
+		b[i] = keyAlphabet[r.Intn(len(keyAlphabet))]
+	}
+	return string(b)
+}
+
+func randomDimensions(r *rand.Rand) map[string]string {
+	dim := map[string]string{}
+	for range r.Intn(4) {
+		dim[randomKeyString(r)] = randomKeyString(r)
+	}
+	return dim
+}
+
+// go test -v -count 1 -run '^TestDimensionKeyProperty$' ./emf
+func TestDimensionKeyProperty(t *testing.T) {
+
+	// distinct (namespace, dimensions) never share a key,
+	// equal (namespace, dimensions) always share a key.
+	property := func(ns1, ns2 string, dim1, dim2 map[string]string) bool {
+		same := ns1 == ns2 && maps.Equal(dim1, dim2)
+		return same == (getDimensionKey(ns1, dim1) == getDimensionKey(ns2, dim2))
+	}
+
+	config := &quick.Config{
+		MaxCount: 100000,
+		Values: func(args []reflect.Value, r *rand.Rand) {
+			ns := randomKeyString(r)
+			dim := randomDimensions(r)
+			args[0] = reflect.ValueOf(ns)
+			args[2] = reflect.ValueOf(dim)
+			if r.Intn(4) == 0 {
+				// exercise the equal case too
+				args[1] = reflect.ValueOf(ns)
+				args[3] = reflect.ValueOf(maps.Clone(dim))
+				return
+			}
+			args[1] = reflect.ValueOf(randomKeyString(r))
+			args[3] = reflect.ValueOf(randomDimensions(r))
+		},
+	}
+
+	if err := quick.Check(property, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -v -count 1 -run '^TestDimensionKeyPropertySplit$' ./emf
+func TestDimensionKeyPropertySplit(t *testing.T) {
+
+	// a single dimension whose value embeds a separator-joined pair
+	// never shares the key of the pair as two dimensions.
+	property := func(k1, v1, k2, v2, sep1, sep2 string) bool {
+		if k1 == k2 {
+			return true // not two distinct dimensions
+		}
+		joined := map[string]string{k1: v1 + sep1 + k2 + sep2 + v2}
+		split := map[string]string{k1: v1, k2: v2}
+		return getDimensionKey("ns1", joined) != getDimensionKey("ns1", split)
+	}
+
+	config := &quick.Config{
+		MaxCount: 100000,
+		Values: func(args []reflect.Value, r *rand.Rand) {
+			for i := range args {
+				args[i] = reflect.ValueOf(randomKeyString(r))
+			}
+		},
+	}
+
+	if err := quick.Check(property, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -v -count 1 -run '^TestRecordZeroAllocs$' ./emf
+func TestRecordZeroAllocs(t *testing.T) {
+	metric := New(Options{})
+	dim := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2", "dimKey3": "dimVal3"}
+	metric1 := MetricDefinition{Name: "speed1", Unit: "Count"}
+	metric.Record("emf-test-ns1", metric1, dim, 1000) // create context
+
+	allocs := testing.AllocsPerRun(100, func() {
+		metric.Record("emf-test-ns1", metric1, dim, 1000)
+	})
+	if allocs != 0 {
+		t.Fatalf("Record allocations: expected=0 got=%v", allocs)
+	}
+}
+
+// go test -bench '^BenchmarkDimensionKey$' -benchmem -run '^$' ./emf
+func BenchmarkDimensionKey(b *testing.B) {
+	dim := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2", "dimKey3": "dimVal3"}
+	for range b.N {
+		var kb keyBuffer
+		kb.compute("emf-test-ns1", dim)
+	}
+}
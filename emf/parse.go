@@ -0,0 +1,187 @@
+package emf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Document is an EMF log line parsed by Parse.
+type Document struct {
+	// Metadata is the _aws member of the document.
+	Metadata Metadata
+
+	// Datums holds the metric datums CloudWatch extracts from the document.
+	Datums []Datum
+
+	// Properties holds root members referenced neither as dimension nor
+	// as metric.
+	Properties map[string]any
+}
+
+// Datum is a metric datum extracted from an EMF document.
+// CloudWatch extracts one datum for every metric under every
+// DimensionSet of a MetricDirective.
+type Datum struct {
+	Namespace  string
+	Dimensions map[string]string // dimension name => dimension value
+	Metric     MetricDefinition
+	Values     []float64
+	Array      bool  // values recorded as an array, even of a single value
+	Timestamp  int64 // unix milli
+}
+
+// Parse errors. Errors returned by Parse wrap one of these, so they can
+// be tested with errors.Is.
+var (
+	ErrInvalidDocument  = errors.New("invalid EMF document")
+	ErrMissingMetadata  = errors.New("missing metadata member _aws")
+	ErrMissingDimension = errors.New("missing dimension value")
+	ErrInvalidDimension = errors.New("dimension value not a string")
+	ErrMissingValue     = errors.New("missing metric value")
+	ErrInvalidValue     = errors.New("metric value not a number or array of numbers")
+)
+
+// Parse parses an EMF log line into its metadata and the metric datums
+// CloudWatch would extract from it.
+func Parse(line []byte) (*Document, error) {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(line, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	meta, hasMeta := root[metadataMember]
+	if !hasMeta {
+		return nil, ErrMissingMetadata
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(meta, &doc.Metadata); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDocument, metadataMember, err)
+	}
+
+	referenced := map[string]bool{metadataMember: true}
+
+	for _, dir := range doc.Metadata.CloudWatchMetrics {
+		if dir == nil {
+			return nil, fmt.Errorf("%w: %s: null MetricDirective", ErrInvalidDocument, metadataMember)
+		}
+		datums, err := parseDirective(root, dir, doc.Metadata.Timestamp, referenced)
+		if err != nil {
+			return nil, err
+		}
+		doc.Datums = append(doc.Datums, datums...)
+	}
+
+	for k, raw := range root {
+		if referenced[k] {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDocument, k, err)
+		}
+		if doc.Properties == nil {
+			doc.Properties = map[string]any{}
+		}
+		doc.Properties[k] = v
+	}
+
+	return doc, nil
+}
+
+// parseDirective extracts the datums for a MetricDirective, marking
+// the root members it references.
+func parseDirective(root map[string]json.RawMessage, dir *MetricDirective, timestamp int64,
+	referenced map[string]bool) ([]Datum, error) {
+
+	values := make([][]float64, len(dir.Metrics))
+	arrays := make([]bool, len(dir.Metrics))
+	for i, md := range dir.Metrics {
+		v, array, err := parseValues(root, md.Name)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		arrays[i] = array
+		referenced[md.Name] = true
+	}
+
+	dimensionSets := dir.Dimensions
+	if len(dimensionSets) == 0 {
+		dimensionSets = []DimensionSet{{}} // metrics without dimensions
+	}
+
+	var datums []Datum
+
+	for _, set := range dimensionSets {
+		dimensions := make(map[string]string, len(set))
+		for _, k := range set {
+			v, err := parseDimension(root, k)
+			if err != nil {
+				return nil, err
+			}
+			dimensions[k] = v
+			referenced[k] = true
+		}
+		for i, md := range dir.Metrics {
+			datums = append(datums, Datum{
+				Namespace:  dir.Namespace,
+				Dimensions: dimensions,
+				Metric:     md,
+				Values:     values[i],
+				Array:      arrays[i],
+				Timestamp:  timestamp,
+			})
+		}
+	}
+
+	return datums, nil
+}
+
+func parseDimension(root map[string]json.RawMessage, name string) (string, error) {
+	raw, found := root[name]
+	if !found {
+		return "", fmt.Errorf("%w: %s", ErrMissingDimension, name)
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidDocument, name, err)
+	}
+	str, isStr := v.(string)
+	if !isStr {
+		return "", fmt.Errorf("%w: %s: %s", ErrInvalidDimension, name, raw)
+	}
+	return str, nil
+}
+
+// parseValues returns the values of metric name, and whether they are
+// an array.
+func parseValues(root map[string]json.RawMessage, name string) ([]float64, bool, error) {
+	raw, found := root[name]
+	if !found {
+		return nil, false, fmt.Errorf("%w: %s", ErrMissingValue, name)
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, false, fmt.Errorf("%w: %s: %v", ErrInvalidDocument, name, err)
+	}
+	switch value := v.(type) {
+	case float64:
+		return []float64{value}, false, nil
+	case []any:
+		if len(value) == 0 {
+			break
+		}
+		list := make([]float64, 0, len(value))
+		for _, e := range value {
+			f, isNum := e.(float64)
+			if !isNum {
+				return nil, false, fmt.Errorf("%w: %s: %s", ErrInvalidValue, name, raw)
+			}
+			list = append(list, f)
+		}
+		return list, true, nil
+	}
+	return nil, false, fmt.Errorf("%w: %s: %s", ErrInvalidValue, name, raw)
+}
@@ -0,0 +1,146 @@
+package emf
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestParseRoundTrip$' ./emf
+func TestParseRoundTrip(t *testing.T) {
+
+	metric := New(Options{UnixMilli: func() int64 { return 1000 }})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2"}
+
+	metric1 := MetricDefinition{
+		Name:              "speed1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+	}
+
+	metric2 := MetricDefinition{
+		Name: "speed2",
+	}
+
+	metric.Record("emf-test-ns1", metric1, dim1, 100)
+	metric.Record("emf-test-ns1", metric2, dim1, 50)
+
+	list := metric.Render()
+	if len(list) != 1 {
+		t.Fatalf("list size: expected=1 got=%d", len(list))
+	}
+
+	doc, err := Parse([]byte(list[0]))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	if doc.Metadata.Timestamp != 1000 {
+		t.Errorf("timestamp: expected=1000 got=%d", doc.Metadata.Timestamp)
+	}
+	if len(doc.Properties) != 0 {
+		t.Errorf("unexpected properties: %v", doc.Properties)
+	}
+
+	expect := []Datum{
+		{Namespace: "emf-test-ns1", Dimensions: dim1, Metric: metric1, Values: []float64{100}, Timestamp: 1000},
+		{Namespace: "emf-test-ns1", Dimensions: dim1, Metric: metric2, Values: []float64{50}, Timestamp: 1000},
+	}
+	requireDatums(t, expect, doc.Datums)
+}
+
+func requireDatums(t *testing.T, expect, got []Datum) {
+	t.Helper()
+	if len(expect) != len(got) {
+		t.Fatalf("datums: expected=%d got=%d: %v", len(expect), len(got), got)
+	}
+	for i := range expect {
+		e, g := expect[i], got[i]
+		if e.Namespace != g.Namespace || e.Metric != g.Metric || e.Timestamp != g.Timestamp || e.Array != g.Array ||
+			!maps.Equal(e.Dimensions, g.Dimensions) || !slices.Equal(e.Values, g.Values) {
+			t.Errorf("datum %d: expected=%+v got=%+v", i, e, g)
+		}
+	}
+}
+
+// go test -v -count 1 -run '^TestParseDimensionSetsAndArrays$' ./emf
+func TestParseDimensionSetsAndArrays(t *testing.T) {
+
+	const line = `{
+		"_aws": {
+			"Timestamp": 1574109732004,
+			"CloudWatchMetrics": [
+				{
+					"Namespace": "lambda-function-metrics",
+					"Dimensions": [["functionVersion"], ["functionVersion", "region"], []],
+					"Metrics": [{"Name": "time", "Unit": "Milliseconds", "StorageResolution": 60}]
+				}
+			]
+		},
+		"functionVersion": "$LATEST",
+		"region": "us-east-1",
+		"time": [100, 200.5],
+		"requestId": "989ffbf8-9ace-4817-a57c-e4dd734019ee"
+	}`
+
+	doc, err := Parse([]byte(line))
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+
+	def := MetricDefinition{Name: "time", Unit: "Milliseconds", StorageResolution: 60}
+	values := []float64{100, 200.5}
+	const ts = 1574109732004
+
+	expect := []Datum{
+		{Namespace: "lambda-function-metrics", Dimensions: map[string]string{"functionVersion": "$LATEST"}, Metric: def, Values: values, Array: true, Timestamp: ts},
+		{Namespace: "lambda-function-metrics", Dimensions: map[string]string{"functionVersion": "$LATEST", "region": "us-east-1"}, Metric: def, Values: values, Array: true, Timestamp: ts},
+		{Namespace: "lambda-function-metrics", Dimensions: map[string]string{}, Metric: def, Values: values, Array: true, Timestamp: ts},
+	}
+	requireDatums(t, expect, doc.Datums)
+
+	if got := doc.Properties["requestId"]; got != "989ffbf8-9ace-4817-a57c-e4dd734019ee" {
+		t.Errorf("property requestId: got=%v", got)
+	}
+	if len(doc.Properties) != 1 {
+		t.Errorf("properties: expected=1 got=%v", doc.Properties)
+	}
+}
+
+// go test -v -count 1 -run '^TestParseErrors$' ./emf
+func TestParseErrors(t *testing.T) {
+
+	const directive = `"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[["d"]],"Metrics":[{"Name":"m"}]}]`
+
+	table := []struct {
+		name   string
+		line   string
+		expect error
+	}{
+		{"not json", `{`, ErrInvalidDocument},
+		{"not object", `[]`, ErrInvalidDocument},
+		{"missing metadata", `{"m":1}`, ErrMissingMetadata},
+		{"bad metadata", `{"_aws":{"CloudWatchMetrics":"x"}}`, ErrInvalidDocument},
+		{"null directive", `{"_aws":{"CloudWatchMetrics":[null]}}`, ErrInvalidDocument},
+		{"missing dimension", `{"_aws":{` + directive + `},"m":1}`, ErrMissingDimension},
+		{"number dimension", `{"_aws":{` + directive + `},"d":1,"m":1}`, ErrInvalidDimension},
+		{"null dimension", `{"_aws":{` + directive + `},"d":null,"m":1}`, ErrInvalidDimension},
+		{"missing value", `{"_aws":{` + directive + `},"d":"x"}`, ErrMissingValue},
+		{"string value", `{"_aws":{` + directive + `},"d":"x","m":"1"}`, ErrInvalidValue},
+		{"null value", `{"_aws":{` + directive + `},"d":"x","m":null}`, ErrInvalidValue},
+		{"empty array", `{"_aws":{` + directive + `},"d":"x","m":[]}`, ErrInvalidValue},
+		{"mixed array", `{"_aws":{` + directive + `},"d":"x","m":[1,"2"]}`, ErrInvalidValue},
+		{"object value", `{"_aws":{` + directive + `},"d":"x","m":{}}`, ErrInvalidValue},
+	}
+
+	for _, data := range table {
+		t.Run(data.name, func(t *testing.T) {
+			_, err := Parse([]byte(data.line))
+			if !errors.Is(err, data.expect) {
+				t.Errorf("expected=%v got=%v", data.expect, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package emf
+
+import "maps"
+
+// Scope is a child recorder derived from Metric with With or WithNamespace.
+// A Scope carries a namespace and a set of dimensions that are applied to
+// every metric recorded through it. All scopes derived from the same Metric
+// write into the same table, hence they are rendered together.
+// A Scope is immutable and safe for concurrent use.
+// The zero value is a no-op scope that discards every metric.
+type Scope struct {
+	metric     *Metric
+	namespace  string
+	dimensions map[string]string
+}
+
+// With creates a scope under the default namespace Options.Namespace
+// with the given dimensions.
+func (m *Metric) With(dimensions map[string]string) *Scope {
+	return &Scope{
+		metric:     m,
+		namespace:  m.options.Namespace,
+		dimensions: maps.Clone(dimensions),
+	}
+}
+
+// WithNamespace creates a scope under namespace without dimensions.
+func (m *Metric) WithNamespace(namespace string) *Scope {
+	return &Scope{
+		metric:    m,
+		namespace: namespace,
+	}
+}
+
+// With creates a child scope that inherits the namespace and dimensions
+// of s and adds the given dimensions. A dimension also present in s is
+// overridden by the new value.
+func (s *Scope) With(dimensions map[string]string) *Scope {
+	dims := make(map[string]string, len(s.dimensions)+len(dimensions))
+	maps.Copy(dims, s.dimensions)
+	maps.Copy(dims, dimensions)
+	return &Scope{
+		metric:     s.metric,
+		namespace:  s.namespace,
+		dimensions: dims,
+	}
+}
+
+// WithNamespace creates a child scope that inherits the dimensions of s
+// under another namespace.
+func (s *Scope) WithNamespace(namespace string) *Scope {
+	return &Scope{
+		metric:     s.metric,
+		namespace:  namespace,
+		dimensions: s.dimensions,
+	}
+}
+
+// Namespace returns the scope namespace.
+func (s *Scope) Namespace() string {
+	return s.namespace
+}
+
+// Dimensions returns a copy of the scope dimensions.
+func (s *Scope) Dimensions() map[string]string {
+	return maps.Clone(s.dimensions)
+}
+
+// Record records a metric with the scope namespace and dimensions.
+func (s *Scope) Record(metric MetricDefinition, value int) {
+	if s.metric == nil {
+		return // no-op scope
+	}
+	s.metric.Record(s.namespace, metric, s.dimensions, value)
+}
+
+// Handle creates a handle for the metric bound to the scope namespace
+// and dimensions.
+func (s *Scope) Handle(metric MetricDefinition) *Handle {
+	if s.metric == nil {
+		return &Handle{} // no-op handle
+	}
+	return s.metric.Handle(s.namespace, metric, s.dimensions)
+}
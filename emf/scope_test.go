@@ -0,0 +1,61 @@
+package emf
+
+import (
+	"slices"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestScope$' ./emf
+func TestScope(t *testing.T) {
+
+	metric := New(Options{
+		UnixMilli: func() int64 { return 0 },
+		Namespace: "emf-test-ns1",
+	})
+
+	metric1 := MetricDefinition{
+		Name: "speed1",
+	}
+
+	service := metric.With(map[string]string{"Service": "users"})
+	getUser := service.With(map[string]string{"Operation": "GetUser"})
+	putUser := service.With(map[string]string{"Operation": "PutUser"})
+
+	service.Record(metric1, 10)
+	getUser.Record(metric1, 20)
+	putUser.Record(metric1, 30)
+	getUser.WithNamespace("emf-test-ns2").Record(metric1, 40)
+
+	expect := []string{
+		`{"Operation":"GetUser","Service":"users","_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["Operation","Service"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":20}`,
+		`{"Operation":"GetUser","Service":"users","_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns2","Dimensions":[["Operation","Service"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":40}`,
+		`{"Operation":"PutUser","Service":"users","_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["Operation","Service"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":30}`,
+		`{"Service":"users","_aws":{"CloudWatchMetrics":[{"Namespace":"emf-test-ns1","Dimensions":[["Service"]],"Metrics":[{"Name":"speed1"}]}],"Timestamp":0},"speed1":10}`,
+	}
+
+	list := metric.Render()
+	slices.Sort(list)
+
+	if !slices.Equal(expect, list) {
+		t.Fatalf("expected=%v got=%v", expect, list)
+	}
+}
+
+// go test -v -count 1 -run '^TestScopeOverride$' ./emf
+func TestScopeOverride(t *testing.T) {
+
+	metric := New(Options{})
+
+	parent := metric.WithNamespace("emf-test-ns1").With(map[string]string{"Operation": "GetUser"})
+	child := parent.With(map[string]string{"Operation": "PutUser"})
+
+	if got := parent.Dimensions()["Operation"]; got != "GetUser" {
+		t.Errorf("parent dimension changed: %s", got)
+	}
+	if got := child.Dimensions()["Operation"]; got != "PutUser" {
+		t.Errorf("child dimension not overridden: %s", got)
+	}
+	if got := child.Namespace(); got != "emf-test-ns1" {
+		t.Errorf("child namespace: expected=emf-test-ns1 got=%s", got)
+	}
+}
@@ -0,0 +1,360 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// EMF specification limits checked by Validate.
+const (
+	MaxDocumentSize         = 1024 * 1024 // CloudWatch Logs maximum event size
+	MaxNamespaceLength      = 255
+	MaxDimensionSetSize     = 30
+	MaxDimensionLength      = 250
+	MaxDimensionValueLength = 1024
+	MaxMetricNameLength     = 1024
+	MaxMetricsPerDirective  = 100
+	MaxValuesPerMetric      = 100
+)
+
+// validUnits holds the units accepted by CloudWatch.
+var validUnits = map[string]bool{
+	"Seconds": true, "Microseconds": true, "Milliseconds": true,
+	"Bytes": true, "Kilobytes": true, "Megabytes": true, "Gigabytes": true, "Terabytes": true,
+	"Bits": true, "Kilobits": true, "Megabits": true, "Gigabits": true, "Terabits": true,
+	"Percent": true, "Count": true,
+	"Bytes/Second": true, "Kilobytes/Second": true, "Megabytes/Second": true,
+	"Gigabytes/Second": true, "Terabytes/Second": true,
+	"Bits/Second": true, "Kilobits/Second": true, "Megabits/Second": true,
+	"Gigabits/Second": true, "Terabits/Second": true,
+	"Count/Second": true, "None": true,
+}
+
+// ValidationError reports a rule violation found by Validate.
+type ValidationError struct {
+	// Path locates the offending member, like _aws.CloudWatchMetrics[0].Namespace.
+	// Empty Path refers to the whole document.
+	Path    string
+	Message string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks an EMF document against the EMF specification:
+// JSON types, required members, references from Dimensions and Metrics
+// to root members and size limits. Validate reports every violation
+// found, as *ValidationError joined by errors.Join, or nil if the
+// document is valid.
+func Validate(line []byte) error {
+	v := validator{}
+	v.validate(line)
+	return errors.Join(v.errs...)
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(line []byte) {
+	if len(line) > MaxDocumentSize {
+		v.fail("", "document size %d exceeds limit %d", len(line), MaxDocumentSize)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		v.fail("", "invalid JSON: %v", err)
+		return
+	}
+	if dec.More() {
+		v.fail("", "trailing data after JSON document")
+		return
+	}
+
+	root, isObj := doc.(map[string]any)
+	if !isObj {
+		v.fail("", "document must be a JSON object, got %s", jsonType(doc))
+		return
+	}
+
+	meta, found := root[metadataMember]
+	if !found {
+		v.fail(metadataMember, "required member missing")
+		return
+	}
+	metaObj, isObj := meta.(map[string]any)
+	if !isObj {
+		v.fail(metadataMember, "must be an object, got %s", jsonType(meta))
+		return
+	}
+
+	v.validateTimestamp(metaObj)
+
+	const cwmPath = metadataMember + ".CloudWatchMetrics"
+	cwm, found := metaObj["CloudWatchMetrics"]
+	if !found {
+		v.fail(cwmPath, "required member missing")
+		return
+	}
+	directives, isArray := cwm.([]any)
+	if !isArray {
+		v.fail(cwmPath, "must be an array, got %s", jsonType(cwm))
+		return
+	}
+
+	for i, dir := range directives {
+		v.validateDirective(root, fmt.Sprintf("%s[%d]", cwmPath, i), dir)
+	}
+}
+
+func (v *validator) validateTimestamp(meta map[string]any) {
+	const path = metadataMember + ".Timestamp"
+	ts, found := meta["Timestamp"]
+	if !found {
+		v.fail(path, "required member missing")
+		return
+	}
+	num, isNum := ts.(json.Number)
+	if !isNum {
+		v.fail(path, "must be a number, got %s", jsonType(ts))
+		return
+	}
+	i, err := num.Int64()
+	if err != nil {
+		v.fail(path, "must be an integer (milliseconds since epoch), got %s", num)
+		return
+	}
+	if i < 0 {
+		v.fail(path, "must not be negative, got %d", i)
+	}
+}
+
+func (v *validator) validateDirective(root map[string]any, path string, dir any) {
+
+	obj, isObj := dir.(map[string]any)
+	if !isObj {
+		v.fail(path, "MetricDirective must be an object, got %s", jsonType(dir))
+		return
+	}
+
+	v.validateNamespace(path+".Namespace", obj)
+
+	dimsPath := path + ".Dimensions"
+	if dims, found := obj["Dimensions"]; !found {
+		v.fail(dimsPath, "required member missing")
+	} else if sets, isArray := dims.([]any); !isArray {
+		v.fail(dimsPath, "must be an array, got %s", jsonType(dims))
+	} else {
+		for i, set := range sets {
+			v.validateDimensionSet(root, fmt.Sprintf("%s[%d]", dimsPath, i), set)
+		}
+	}
+
+	metricsPath := path + ".Metrics"
+	metrics, found := obj["Metrics"]
+	if !found {
+		v.fail(metricsPath, "required member missing")
+		return
+	}
+	list, isArray := metrics.([]any)
+	if !isArray {
+		v.fail(metricsPath, "must be an array, got %s", jsonType(metrics))
+		return
+	}
+	if len(list) > MaxMetricsPerDirective {
+		v.fail(metricsPath, "%d metrics exceed limit %d", len(list), MaxMetricsPerDirective)
+	}
+	for i, md := range list {
+		v.validateMetricDefinition(root, fmt.Sprintf("%s[%d]", metricsPath, i), md)
+	}
+}
+
+func (v *validator) validateNamespace(path string, dir map[string]any) {
+	ns, found := dir["Namespace"]
+	if !found {
+		v.fail(path, "required member missing")
+		return
+	}
+	str, isStr := ns.(string)
+	if !isStr {
+		v.fail(path, "must be a string, got %s", jsonType(ns))
+		return
+	}
+	if strings.TrimFunc(str, unicode.IsSpace) == "" {
+		v.fail(path, "must contain a non-whitespace character")
+	}
+	if n := utf8.RuneCountInString(str); n > MaxNamespaceLength {
+		v.fail(path, "length %d exceeds limit %d", n, MaxNamespaceLength)
+	}
+}
+
+func (v *validator) validateDimensionSet(root map[string]any, path string, set any) {
+	list, isArray := set.([]any)
+	if !isArray {
+		v.fail(path, "DimensionSet must be an array, got %s", jsonType(set))
+		return
+	}
+	if len(list) > MaxDimensionSetSize {
+		v.fail(path, "%d dimensions exceed limit %d", len(list), MaxDimensionSetSize)
+	}
+	for i, dim := range list {
+		dimPath := fmt.Sprintf("%s[%d]", path, i)
+		name, isStr := dim.(string)
+		if !isStr {
+			v.fail(dimPath, "dimension name must be a string, got %s", jsonType(dim))
+			continue
+		}
+		if name == "" {
+			v.fail(dimPath, "dimension name must not be empty")
+			continue
+		}
+		if n := utf8.RuneCountInString(name); n > MaxDimensionLength {
+			v.fail(dimPath, "dimension name length %d exceeds limit %d", n, MaxDimensionLength)
+		}
+		val, found := root[name]
+		if !found {
+			v.fail(dimPath, "dimension %q has no root member", name)
+			continue
+		}
+		str, isStr := val.(string)
+		if !isStr {
+			v.fail(name, "dimension value must be a string, got %s", jsonType(val))
+			continue
+		}
+		if str == "" {
+			v.fail(name, "dimension value must not be empty")
+		}
+		if n := utf8.RuneCountInString(str); n > MaxDimensionValueLength {
+			v.fail(name, "dimension value length %d exceeds limit %d", n, MaxDimensionValueLength)
+		}
+	}
+}
+
+func (v *validator) validateMetricDefinition(root map[string]any, path string, md any) {
+	obj, isObj := md.(map[string]any)
+	if !isObj {
+		v.fail(path, "MetricDefinition must be an object, got %s", jsonType(md))
+		return
+	}
+
+	v.validateUnit(path, obj)
+	v.validateStorageResolution(path, obj)
+
+	name, valid := v.validateMetricName(path, obj)
+	if !valid {
+		return
+	}
+
+	val, found := root[name]
+	if !found {
+		v.fail(path+".Name", "metric %q has no root member", name)
+		return
+	}
+	v.validateMetricValue(name, val)
+}
+
+func (v *validator) validateUnit(path string, obj map[string]any) {
+	unit, found := obj["Unit"]
+	if !found {
+		return
+	}
+	if str, isStr := unit.(string); !isStr {
+		v.fail(path+".Unit", "must be a string, got %s", jsonType(unit))
+	} else if !validUnits[str] {
+		v.fail(path+".Unit", "invalid unit %q", str)
+	}
+}
+
+func (v *validator) validateStorageResolution(path string, obj map[string]any) {
+	res, found := obj["StorageResolution"]
+	if !found {
+		return
+	}
+	if num, isNum := res.(json.Number); !isNum {
+		v.fail(path+".StorageResolution", "must be a number, got %s", jsonType(res))
+	} else if s := num.String(); s != "1" && s != "60" {
+		v.fail(path+".StorageResolution", "must be 1 or 60, got %s", s)
+	}
+}
+
+// validateMetricName returns the metric name, reporting false if it is
+// missing, not a string or empty.
+func (v *validator) validateMetricName(path string, obj map[string]any) (string, bool) {
+	namePath := path + ".Name"
+	nameVal, found := obj["Name"]
+	if !found {
+		v.fail(namePath, "required member missing")
+		return "", false
+	}
+	name, isStr := nameVal.(string)
+	if !isStr {
+		v.fail(namePath, "must be a string, got %s", jsonType(nameVal))
+		return "", false
+	}
+	if name == "" {
+		v.fail(namePath, "must not be empty")
+		return "", false
+	}
+	if n := utf8.RuneCountInString(name); n > MaxMetricNameLength {
+		v.fail(namePath, "length %d exceeds limit %d", n, MaxMetricNameLength)
+	}
+	return name, true
+}
+
+// validateMetricValue validates the root member holding the values of
+// metric name.
+func (v *validator) validateMetricValue(name string, val any) {
+	switch value := val.(type) {
+	case json.Number:
+		// ok
+	case []any:
+		if len(value) == 0 {
+			v.fail(name, "metric value array must not be empty")
+		}
+		if len(value) > MaxValuesPerMetric {
+			v.fail(name, "%d metric values exceed limit %d", len(value), MaxValuesPerMetric)
+		}
+		for i, e := range value {
+			if _, isNum := e.(json.Number); !isNum {
+				v.fail(fmt.Sprintf("%s[%d]", name, i), "metric value must be a number, got %s", jsonType(e))
+			}
+		}
+	default:
+		v.fail(name, "metric value must be a number or an array of numbers, got %s", jsonType(val))
+	}
+}
+
+// jsonType names the JSON type of a value decoded with UseNumber.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
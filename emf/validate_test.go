@@ -0,0 +1,128 @@
+package emf
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// go test -v -count 1 -run '^TestValidateRendered$' ./emf
+func TestValidateRendered(t *testing.T) {
+
+	metric := New(Options{})
+
+	dim1 := map[string]string{"dimKey1": "dimVal1"}
+	dim2 := map[string]string{"dimKey1": "dimVal1", "dimKey2": "dimVal2"}
+
+	metric1 := MetricDefinition{
+		Name:              "metric1",
+		Unit:              "Bytes/Second",
+		StorageResolution: 1,
+	}
+
+	metric2 := MetricDefinition{
+		Name: "metric2",
+	}
+
+	metric.Record("emf-test-ns1", metric1, nil, 10)
+	metric.Record("emf-test-ns1", metric1, dim1, 20)
+	metric.Record("emf-test-ns1", metric1, dim2, 30)
+	metric.Record("emf-test-ns1", metric2, nil, 40)
+	metric.Record("emf-test-ns2", metric1, nil, 50)
+
+	for _, line := range metric.Render() {
+		if err := Validate([]byte(line)); err != nil {
+			t.Errorf("unexpected error: %v: %s", err, line)
+		}
+	}
+}
+
+// validationPaths returns the paths of all validation errors in err.
+func validationPaths(t *testing.T, err error) []string {
+	t.Helper()
+	var paths []string
+	joined, isJoined := err.(interface{ Unwrap() []error })
+	if !isJoined {
+		t.Fatalf("expected joined errors, got: %v", err)
+	}
+	for _, e := range joined.Unwrap() {
+		var ve *ValidationError
+		if !errors.As(e, &ve) {
+			t.Fatalf("not a validation error: %v", e)
+		}
+		paths = append(paths, ve.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// go test -v -count 1 -run '^TestValidateErrors$' ./emf
+func TestValidateErrors(t *testing.T) {
+
+	const meta = `"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[["d"]],"Metrics":[{"Name":"m","Unit":"Count","StorageResolution":60}]}]}`
+
+	table := []struct {
+		name   string
+		line   string
+		expect []string // sorted error paths
+	}{
+		{"valid", `{` + meta + `,"d":"x","m":[1,2.5]}`, nil},
+		{"not json", `{`, []string{""}},
+		{"trailing data", `{} {}`, []string{""}},
+		{"not object", `[1]`, []string{""}},
+		{"missing _aws", `{"m":1}`, []string{"_aws"}},
+		{"_aws not object", `{"_aws":1}`, []string{"_aws"}},
+		{"missing timestamp", `{"_aws":{"CloudWatchMetrics":[]}}`, []string{"_aws.Timestamp"}},
+		{"string timestamp", `{"_aws":{"Timestamp":"1","CloudWatchMetrics":[]}}`, []string{"_aws.Timestamp"}},
+		{"float timestamp", `{"_aws":{"Timestamp":1.5,"CloudWatchMetrics":[]}}`, []string{"_aws.Timestamp"}},
+		{"negative timestamp", `{"_aws":{"Timestamp":-1,"CloudWatchMetrics":[]}}`, []string{"_aws.Timestamp"}},
+		{"missing directives", `{"_aws":{"Timestamp":1}}`, []string{"_aws.CloudWatchMetrics"}},
+		{"directive not object", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[1]}}`, []string{"_aws.CloudWatchMetrics[0]"}},
+		{"empty directive", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{}]}}`, []string{
+			"_aws.CloudWatchMetrics[0].Dimensions",
+			"_aws.CloudWatchMetrics[0].Metrics",
+			"_aws.CloudWatchMetrics[0].Namespace",
+		}},
+		{"blank namespace", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":" ","Dimensions":[],"Metrics":[]}]}}`,
+			[]string{"_aws.CloudWatchMetrics[0].Namespace"}},
+		{"long namespace", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"` + strings.Repeat("n", MaxNamespaceLength+1) + `","Dimensions":[],"Metrics":[]}]}}`,
+			[]string{"_aws.CloudWatchMetrics[0].Namespace"}},
+		{"missing dimension", `{` + meta + `,"m":1}`, []string{"_aws.CloudWatchMetrics[0].Dimensions[0][0]"}},
+		{"number dimension", `{` + meta + `,"d":1,"m":1}`, []string{"d"}},
+		{"empty dimension", `{` + meta + `,"d":"","m":1}`, []string{"d"}},
+		{"dimension set not array", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":["d"],"Metrics":[]}]},"d":"x"}`,
+			[]string{"_aws.CloudWatchMetrics[0].Dimensions[0]"}},
+		{"too many dimensions", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[[` + strings.Repeat(`"d",`, MaxDimensionSetSize) + `"d"]],"Metrics":[]}]},"d":"x"}`,
+			[]string{"_aws.CloudWatchMetrics[0].Dimensions[0]"}},
+		{"missing metric", `{` + meta + `,"d":"x"}`, []string{"_aws.CloudWatchMetrics[0].Metrics[0].Name"}},
+		{"string metric", `{` + meta + `,"d":"x","m":"1"}`, []string{"m"}},
+		{"empty metric array", `{` + meta + `,"d":"x","m":[]}`, []string{"m"}},
+		{"bad metric array", `{` + meta + `,"d":"x","m":[1,null,"2"]}`, []string{"m[1]", "m[2]"}},
+		{"too many values", `{` + meta + `,"d":"x","m":[` + strings.Repeat("1,", MaxValuesPerMetric) + `1]}`, []string{"m"}},
+		{"bad unit and resolution", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[],"Metrics":[{"Name":"m","Unit":"Meters","StorageResolution":30}]}]},"m":1}`,
+			[]string{"_aws.CloudWatchMetrics[0].Metrics[0].StorageResolution", "_aws.CloudWatchMetrics[0].Metrics[0].Unit"}},
+		{"metric without name", `{"_aws":{"Timestamp":1,"CloudWatchMetrics":[{"Namespace":"ns","Dimensions":[],"Metrics":[{}]}]}}`,
+			[]string{"_aws.CloudWatchMetrics[0].Metrics[0].Name"}},
+		{"document too large", `{` + meta + `,"d":"x","m":1,"p":"` + strings.Repeat("p", MaxDocumentSize) + `"}`, []string{""}},
+	}
+
+	for _, data := range table {
+		t.Run(data.name, func(t *testing.T) {
+			err := Validate([]byte(data.line))
+			if data.expect == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error at %v", data.expect)
+			}
+			t.Logf("%v", err)
+			if paths := validationPaths(t, err); !slices.Equal(data.expect, paths) {
+				t.Fatalf("paths: expected=%q got=%q", data.expect, paths)
+			}
+		})
+	}
+}
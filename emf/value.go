@@ -0,0 +1,100 @@
+package emf
+
+import (
+	"math"
+	"slices"
+	"strconv"
+)
+
+// value holds the value recorded for a metric: an integer, a float or
+// an array of values.
+type value struct {
+	kind   valueKind
+	i      int
+	f      float64
+	values []float64 // never modified in place, may be shared by snapshots
+}
+
+type valueKind uint8
+
+const (
+	valueInt valueKind = iota
+	valueFloat
+	valueArray
+)
+
+func intValue(v int) value {
+	return value{i: v}
+}
+
+func floatValue(v float64) value {
+	return value{kind: valueFloat, f: v}
+}
+
+// arrayValue keeps up to MaxValuesPerMetric finite values.
+func arrayValue(values []float64) value {
+	list := make([]float64, 0, min(len(values), MaxValuesPerMetric))
+	for _, v := range values {
+		if len(list) == MaxValuesPerMetric {
+			break
+		}
+		if finite(v) {
+			list = append(list, v)
+		}
+	}
+	return value{kind: valueArray, values: list}
+}
+
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// float64s returns the value as datum values.
+func (v value) float64s() []float64 {
+	switch v.kind {
+	case valueFloat:
+		return []float64{v.f}
+	case valueArray:
+		return slices.Clone(v.values)
+	}
+	return []float64{float64(v.i)}
+}
+
+// appendValue appends v as JSON number or array of numbers.
+func appendValue(b []byte, v value) []byte {
+	switch v.kind {
+	case valueFloat:
+		return appendJSONFloat(b, v.f)
+	case valueArray:
+		b = append(b, '[')
+		for i, f := range v.values {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONFloat(b, f)
+		}
+		return append(b, ']')
+	}
+	return strconv.AppendInt(b, int64(v.i), 10)
+}
+
+// appendJSONFloat formats a finite float64 as encoding/json does:
+// exponent notation only for very small or very large magnitudes,
+// with the exponent of small numbers trimmed as in 1e-7.
+func appendJSONFloat(b []byte, f float64) []byte {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}